@@ -1,39 +1,301 @@
 package log_v1
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail attached to every error
+// in this package. Its Reason says which error it is.
+const ErrorDomain = "proglog"
+
+// The reasons in the ErrorInfo detail of each error.
+const (
+	ReasonOffsetOutOfRange = "OFFSET_OUT_OF_RANGE"
+	ReasonNotLeader        = "NOT_LEADER"
+	ReasonCorruptRecord    = "CORRUPT_RECORD"
+	ReasonLogClosed        = "LOG_CLOSED"
+	ReasonTopicNotFound    = "TOPIC_NOT_FOUND"
+	ReasonUnauthenticated  = "UNAUTHENTICATED"
+	ReasonPermissionDenied = "PERMISSION_DENIED"
 )
 
+// newStatus builds a status with an ErrorInfo detail for reason and a
+// LocalizedMessage detail for people, followed by any extra details.
+func newStatus(
+	code codes.Code,
+	msg string,
+	reason string,
+	metadata map[string]string,
+	localized string,
+	extra ...protoadapt.MessageV1,
+) *status.Status {
+	st := status.New(code, msg)
+
+	details := append([]protoadapt.MessageV1{
+		&errdetails.ErrorInfo{
+			Reason:   reason,
+			Domain:   ErrorDomain,
+			Metadata: metadata,
+		},
+		&errdetails.LocalizedMessage{
+			Locale:  "en-US",
+			Message: localized,
+		},
+	}, extra...)
+
+	std, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+
+	return std
+}
+
 type ErrOffsetOutOfRange struct {
 	Offset uint64
 }
 
 func (e ErrOffsetOutOfRange) GRPCStatus() *status.Status {
-	st := status.New(
-		404,
+	return newStatus(
+		codes.OutOfRange,
 		fmt.Sprintf("offset out of range: %d", e.Offset),
+		ReasonOffsetOutOfRange,
+		map[string]string{"offset": strconv.FormatUint(e.Offset, 10)},
+		fmt.Sprintf(
+			"The requested offset is outside the log's range: %d",
+			e.Offset,
+		),
 	)
+}
 
-	msg := fmt.Sprintf(
-		"The requested offset is outside the log's range: %d",
-		e.Offset,
+func (e ErrOffsetOutOfRange) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrNotLeader is returned when a write reaches a follower.
+type ErrNotLeader struct{}
+
+func (e ErrNotLeader) GRPCStatus() *status.Status {
+	return newStatus(
+		codes.FailedPrecondition,
+		"not the leader",
+		ReasonNotLeader,
+		nil,
+		"This server is a follower and doesn't accept writes; send them to the leader",
 	)
+}
 
-	d := &errdetails.LocalizedMessage{
-		Locale:  "en-US",
-		Message: msg,
-	}
+func (e ErrNotLeader) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
 
-	std, err := st.WithDetails(d)
-	if err != nil {
-		return st
+// ErrCorruptRecord is returned when the record at Offset can't be read back
+// from disk, such as when its bytes don't unmarshal. Err is the cause, if
+// known; it isn't sent to clients.
+type ErrCorruptRecord struct {
+	Offset uint64
+	Err    error
+}
+
+func (e ErrCorruptRecord) GRPCStatus() *status.Status {
+	return newStatus(
+		codes.DataLoss,
+		fmt.Sprintf("corrupt record: %d", e.Offset),
+		ReasonCorruptRecord,
+		map[string]string{"offset": strconv.FormatUint(e.Offset, 10)},
+		fmt.Sprintf(
+			"The record at offset %d is corrupt and can't be read",
+			e.Offset,
+		),
+	)
+}
+
+func (e ErrCorruptRecord) Error() string {
+	if e.Err == nil {
+		return e.GRPCStatus().Err().Error()
 	}
 
-	return std
+	return fmt.Sprintf("%s: %v", e.GRPCStatus().Err().Error(), e.Err)
 }
 
-func (e ErrOffsetOutOfRange) Error() string {
+func (e ErrCorruptRecord) Unwrap() error {
+	return e.Err
+}
+
+// ErrLogClosed is returned by calls on a log that has been closed, such as
+// while the server shuts down.
+type ErrLogClosed struct{}
+
+func (e ErrLogClosed) GRPCStatus() *status.Status {
+	return newStatus(
+		codes.Unavailable,
+		"log closed",
+		ReasonLogClosed,
+		nil,
+		"The log is closed; retry against another server",
+	)
+}
+
+func (e ErrLogClosed) Error() string {
 	return e.GRPCStatus().Err().Error()
 }
+
+// ErrTopicNotFound is returned when a request names a topic the server
+// doesn't have.
+type ErrTopicNotFound struct {
+	Topic string
+}
+
+func (e ErrTopicNotFound) GRPCStatus() *status.Status {
+	return newStatus(
+		codes.NotFound,
+		fmt.Sprintf("topic not found: %s", e.Topic),
+		ReasonTopicNotFound,
+		map[string]string{"topic": e.Topic},
+		fmt.Sprintf("There's no topic named %q", e.Topic),
+		&errdetails.ResourceInfo{
+			ResourceType: "topic",
+			ResourceName: e.Topic,
+		},
+	)
+}
+
+func (e ErrTopicNotFound) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrUnauthenticated is returned when the caller's credential isn't valid.
+// Reason says why, such as the token having expired.
+type ErrUnauthenticated struct {
+	Reason string
+}
+
+func (e ErrUnauthenticated) GRPCStatus() *status.Status {
+	return newStatus(
+		codes.Unauthenticated,
+		fmt.Sprintf("unauthenticated: %s", e.Reason),
+		ReasonUnauthenticated,
+		map[string]string{"reason": e.Reason},
+		"The credential sent with the request isn't valid",
+	)
+}
+
+func (e ErrUnauthenticated) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrPermissionDenied is returned when the policy doesn't let Subject perform
+// Action on Object.
+type ErrPermissionDenied struct {
+	Subject string
+	Object  string
+	Action  string
+}
+
+func (e ErrPermissionDenied) GRPCStatus() *status.Status {
+	return newStatus(
+		codes.PermissionDenied,
+		fmt.Sprintf("%s not permitted to %s to %s", e.Subject, e.Action, e.Object),
+		ReasonPermissionDenied,
+		map[string]string{
+			"subject": e.Subject,
+			"object":  e.Object,
+			"action":  e.Action,
+		},
+		fmt.Sprintf("You aren't permitted to %s", e.Action),
+	)
+}
+
+func (e ErrPermissionDenied) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrorInfo returns the ErrorInfo detail of a status error returned by the
+// server, or nil if it has none.
+func ErrorInfo(err error) *errdetails.ErrorInfo {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok && info.Domain == ErrorDomain {
+			return info
+		}
+	}
+
+	return nil
+}
+
+// FromError turns a status error returned by the server back into the error
+// in this package it was made from, so clients can check it with errors.As.
+// Other errors are returned as they are.
+func FromError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Errors from this package, such as ones returned in-process, are
+	// already decoded.
+	var s interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &s) {
+		switch s.(type) {
+		case ErrOffsetOutOfRange, ErrNotLeader, ErrCorruptRecord, ErrLogClosed,
+			ErrTopicNotFound, ErrUnauthenticated, ErrPermissionDenied:
+			return err
+		}
+	}
+
+	info := ErrorInfo(err)
+	if info == nil {
+		return err
+	}
+
+	md := info.Metadata
+	offset := func() uint64 {
+		off, _ := strconv.ParseUint(md["offset"], 10, 64)
+		return off
+	}
+
+	switch info.Reason {
+	case ReasonOffsetOutOfRange:
+		return ErrOffsetOutOfRange{Offset: offset()}
+	case ReasonNotLeader:
+		return ErrNotLeader{}
+	case ReasonCorruptRecord:
+		return ErrCorruptRecord{Offset: offset()}
+	case ReasonLogClosed:
+		return ErrLogClosed{}
+	case ReasonTopicNotFound:
+		return ErrTopicNotFound{Topic: md["topic"]}
+	case ReasonUnauthenticated:
+		return ErrUnauthenticated{Reason: md["reason"]}
+	case ReasonPermissionDenied:
+		return ErrPermissionDenied{
+			Subject: md["subject"],
+			Object:  md["object"],
+			Action:  md["action"],
+		}
+	}
+
+	return err
+}
+
+// IsOffsetOutOfRange reports whether err, from the server or in-process, is
+// an ErrOffsetOutOfRange.
+func IsOffsetOutOfRange(err error) bool {
+	return errors.As(FromError(err), &ErrOffsetOutOfRange{})
+}
+
+// IsNotLeader reports whether err, from the server or in-process, is an
+// ErrNotLeader.
+func IsNotLeader(err error) bool {
+	return errors.As(FromError(err), &ErrNotLeader{})
+}
@@ -0,0 +1,54 @@
+package log_v1
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestErrors tests that each error has a proper gRPC code and that clients
+// decode it back from the status they receive.
+func TestErrors(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code codes.Code
+	}{
+		{ErrOffsetOutOfRange{Offset: 7}, codes.OutOfRange},
+		{ErrNotLeader{}, codes.FailedPrecondition},
+		{ErrCorruptRecord{Offset: 3}, codes.DataLoss},
+		{ErrLogClosed{}, codes.Unavailable},
+		{ErrTopicNotFound{Topic: "orders"}, codes.NotFound},
+		{ErrUnauthenticated{Reason: "token has expired"}, codes.Unauthenticated},
+		{ErrPermissionDenied{Subject: "nobody", Object: "*", Action: "produce"}, codes.PermissionDenied},
+	} {
+		t.Run(fmt.Sprintf("%T", tc.err), func(t *testing.T) {
+			require.Equal(t, tc.code, status.Code(tc.err))
+
+			// Round trip the status through its wire form, as a client
+			// receives it.
+			b, err := proto.Marshal(status.Convert(tc.err).Proto())
+			require.NoError(t, err)
+			wire := &spb.Status{}
+			require.NoError(t, proto.Unmarshal(b, wire))
+			received := status.ErrorProto(wire)
+
+			require.Equal(t, tc.err, FromError(received))
+			require.NotNil(t, ErrorInfo(received))
+		})
+	}
+
+	// Errors that wrap a cause still decode in-process.
+	err := fmt.Errorf("read: %w", ErrOffsetOutOfRange{Offset: 1})
+	require.True(t, IsOffsetOutOfRange(err))
+	require.False(t, IsNotLeader(err))
+
+	plain := errors.New("plain")
+	require.Equal(t, plain, FromError(plain))
+	require.Nil(t, FromError(nil))
+}
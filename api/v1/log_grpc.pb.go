@@ -23,6 +23,9 @@ const (
 	Log_ProduceStream_FullMethodName = "/log.v1.Log/ProduceStream"
 	Log_Consume_FullMethodName       = "/log.v1.Log/Consume"
 	Log_ConsumeStream_FullMethodName = "/log.v1.Log/ConsumeStream"
+	Log_ConsumeFlow_FullMethodName   = "/log.v1.Log/ConsumeFlow"
+	Log_ConsumeRange_FullMethodName  = "/log.v1.Log/ConsumeRange"
+	Log_GetServers_FullMethodName    = "/log.v1.Log/GetServers"
 )
 
 // LogClient is the client API for Log service.
@@ -30,9 +33,28 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type LogClient interface {
 	Produce(ctx context.Context, in *ProduceRequest, opts ...grpc.CallOption) (*ProduceResponse, error)
+	// ProduceStream has no HTTP mapping since the gateway can't stream
+	// requests. Responses come back in request order. The server reads
+	// ahead of its responses by a bounded window, and stops reading while
+	// the window is full.
 	ProduceStream(ctx context.Context, opts ...grpc.CallOption) (Log_ProduceStreamClient, error)
 	Consume(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (*ConsumeResponse, error)
 	ConsumeStream(ctx context.Context, in *ConsumeRequest, opts ...grpc.CallOption) (Log_ConsumeStreamClient, error)
+	// ConsumeFlow is ConsumeStream with credit-based flow control: the
+	// server only sends as many records as the client has granted credits
+	// for, so slow consumers hold it back instead of queuing records. The
+	// first message names where to start; every message can grant more
+	// credits.
+	//
+	// It's a separate RPC because granting credits needs a client stream.
+	// Making ConsumeStream bidirectional would break its existing clients
+	// and followers, and HTTP gateways can't serve bidirectional streams,
+	// so ConsumeStream stays server-streaming.
+	ConsumeFlow(ctx context.Context, opts ...grpc.CallOption) (Log_ConsumeFlowClient, error)
+	// ConsumeRange returns a bounded batch of records and the offset the
+	// next batch starts at.
+	ConsumeRange(ctx context.Context, in *ConsumeRangeRequest, opts ...grpc.CallOption) (*ConsumeRangeResponse, error)
+	GetServers(ctx context.Context, in *GetServersRequest, opts ...grpc.CallOption) (*GetServersResponse, error)
 }
 
 type logClient struct {
@@ -124,14 +146,82 @@ func (x *logConsumeStreamClient) Recv() (*ConsumeResponse, error) {
 	return m, nil
 }
 
+func (c *logClient) ConsumeFlow(ctx context.Context, opts ...grpc.CallOption) (Log_ConsumeFlowClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[2], Log_ConsumeFlow_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &logConsumeFlowClient{stream}
+	return x, nil
+}
+
+type Log_ConsumeFlowClient interface {
+	Send(*ConsumeFlowRequest) error
+	Recv() (*ConsumeResponse, error)
+	grpc.ClientStream
+}
+
+type logConsumeFlowClient struct {
+	grpc.ClientStream
+}
+
+func (x *logConsumeFlowClient) Send(m *ConsumeFlowRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *logConsumeFlowClient) Recv() (*ConsumeResponse, error) {
+	m := new(ConsumeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *logClient) ConsumeRange(ctx context.Context, in *ConsumeRangeRequest, opts ...grpc.CallOption) (*ConsumeRangeResponse, error) {
+	out := new(ConsumeRangeResponse)
+	err := c.cc.Invoke(ctx, Log_ConsumeRange_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) GetServers(ctx context.Context, in *GetServersRequest, opts ...grpc.CallOption) (*GetServersResponse, error) {
+	out := new(GetServersResponse)
+	err := c.cc.Invoke(ctx, Log_GetServers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // LogServer is the server API for Log service.
 // All implementations must embed UnimplementedLogServer
 // for forward compatibility
 type LogServer interface {
 	Produce(context.Context, *ProduceRequest) (*ProduceResponse, error)
+	// ProduceStream has no HTTP mapping since the gateway can't stream
+	// requests. Responses come back in request order. The server reads
+	// ahead of its responses by a bounded window, and stops reading while
+	// the window is full.
 	ProduceStream(Log_ProduceStreamServer) error
 	Consume(context.Context, *ConsumeRequest) (*ConsumeResponse, error)
 	ConsumeStream(*ConsumeRequest, Log_ConsumeStreamServer) error
+	// ConsumeFlow is ConsumeStream with credit-based flow control: the
+	// server only sends as many records as the client has granted credits
+	// for, so slow consumers hold it back instead of queuing records. The
+	// first message names where to start; every message can grant more
+	// credits.
+	//
+	// It's a separate RPC because granting credits needs a client stream.
+	// Making ConsumeStream bidirectional would break its existing clients
+	// and followers, and HTTP gateways can't serve bidirectional streams,
+	// so ConsumeStream stays server-streaming.
+	ConsumeFlow(Log_ConsumeFlowServer) error
+	// ConsumeRange returns a bounded batch of records and the offset the
+	// next batch starts at.
+	ConsumeRange(context.Context, *ConsumeRangeRequest) (*ConsumeRangeResponse, error)
+	GetServers(context.Context, *GetServersRequest) (*GetServersResponse, error)
 	mustEmbedUnimplementedLogServer()
 }
 
@@ -151,6 +241,15 @@ func (UnimplementedLogServer) Consume(context.Context, *ConsumeRequest) (*Consum
 func (UnimplementedLogServer) ConsumeStream(*ConsumeRequest, Log_ConsumeStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method ConsumeStream not implemented")
 }
+func (UnimplementedLogServer) ConsumeFlow(Log_ConsumeFlowServer) error {
+	return status.Errorf(codes.Unimplemented, "method ConsumeFlow not implemented")
+}
+func (UnimplementedLogServer) ConsumeRange(context.Context, *ConsumeRangeRequest) (*ConsumeRangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConsumeRange not implemented")
+}
+func (UnimplementedLogServer) GetServers(context.Context, *GetServersRequest) (*GetServersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServers not implemented")
+}
 func (UnimplementedLogServer) mustEmbedUnimplementedLogServer() {}
 
 // UnsafeLogServer may be embedded to opt out of forward compatibility for this service.
@@ -247,6 +346,68 @@ func (x *logConsumeStreamServer) Send(m *ConsumeResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Log_ConsumeFlow_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LogServer).ConsumeFlow(&logConsumeFlowServer{stream})
+}
+
+type Log_ConsumeFlowServer interface {
+	Send(*ConsumeResponse) error
+	Recv() (*ConsumeFlowRequest, error)
+	grpc.ServerStream
+}
+
+type logConsumeFlowServer struct {
+	grpc.ServerStream
+}
+
+func (x *logConsumeFlowServer) Send(m *ConsumeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *logConsumeFlowServer) Recv() (*ConsumeFlowRequest, error) {
+	m := new(ConsumeFlowRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Log_ConsumeRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConsumeRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).ConsumeRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_ConsumeRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).ConsumeRange(ctx, req.(*ConsumeRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_GetServers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetServers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetServers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetServers(ctx, req.(*GetServersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Log_ServiceDesc is the grpc.ServiceDesc for Log service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -262,6 +423,14 @@ var Log_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Consume",
 			Handler:    _Log_Consume_Handler,
 		},
+		{
+			MethodName: "ConsumeRange",
+			Handler:    _Log_ConsumeRange_Handler,
+		},
+		{
+			MethodName: "GetServers",
+			Handler:    _Log_GetServers_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -275,6 +444,368 @@ var Log_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Log_ConsumeStream_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "ConsumeFlow",
+			Handler:       _Log_ConsumeFlow_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "api/v1/log.proto",
+}
+
+const (
+	Admin_DescribeCluster_FullMethodName  = "/log.v1.Admin/DescribeCluster"
+	Admin_Snapshot_FullMethodName         = "/log.v1.Admin/Snapshot"
+	Admin_DescribeLog_FullMethodName      = "/log.v1.Admin/DescribeLog"
+	Admin_RollSegment_FullMethodName      = "/log.v1.Admin/RollSegment"
+	Admin_TruncateLog_FullMethodName      = "/log.v1.Admin/TruncateLog"
+	Admin_DeleteLog_FullMethodName        = "/log.v1.Admin/DeleteLog"
+	Admin_EnforceRetention_FullMethodName = "/log.v1.Admin/EnforceRetention"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	DescribeCluster(ctx context.Context, in *DescribeClusterRequest, opts ...grpc.CallOption) (*DescribeClusterResponse, error)
+	Snapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (Admin_SnapshotClient, error)
+	// The log RPCs act on the log of the node that answers them, not the
+	// cluster's.
+	DescribeLog(ctx context.Context, in *DescribeLogRequest, opts ...grpc.CallOption) (*DescribeLogResponse, error)
+	RollSegment(ctx context.Context, in *RollSegmentRequest, opts ...grpc.CallOption) (*RollSegmentResponse, error)
+	TruncateLog(ctx context.Context, in *TruncateLogRequest, opts ...grpc.CallOption) (*TruncateLogResponse, error)
+	// DeleteLog deletes the topic. There's a single log, so that's every
+	// record. Offsets carry on from where the log ended, so followers and
+	// consumers never see an offset reused for a different record.
+	DeleteLog(ctx context.Context, in *DeleteLogRequest, opts ...grpc.CallOption) (*DeleteLogResponse, error)
+	// EnforceRetention removes the oldest segments the retention policy no
+	// longer keeps. Records have no keys, so there's nothing to compact and
+	// retention is the only cleanup.
+	EnforceRetention(ctx context.Context, in *EnforceRetentionRequest, opts ...grpc.CallOption) (*EnforceRetentionResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) DescribeCluster(ctx context.Context, in *DescribeClusterRequest, opts ...grpc.CallOption) (*DescribeClusterResponse, error) {
+	out := new(DescribeClusterResponse)
+	err := c.cc.Invoke(ctx, Admin_DescribeCluster_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Snapshot(ctx context.Context, in *SnapshotRequest, opts ...grpc.CallOption) (Admin_SnapshotClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Admin_ServiceDesc.Streams[0], Admin_Snapshot_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adminSnapshotClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Admin_SnapshotClient interface {
+	Recv() (*SnapshotChunk, error)
+	grpc.ClientStream
+}
+
+type adminSnapshotClient struct {
+	grpc.ClientStream
+}
+
+func (x *adminSnapshotClient) Recv() (*SnapshotChunk, error) {
+	m := new(SnapshotChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adminClient) DescribeLog(ctx context.Context, in *DescribeLogRequest, opts ...grpc.CallOption) (*DescribeLogResponse, error) {
+	out := new(DescribeLogResponse)
+	err := c.cc.Invoke(ctx, Admin_DescribeLog_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RollSegment(ctx context.Context, in *RollSegmentRequest, opts ...grpc.CallOption) (*RollSegmentResponse, error) {
+	out := new(RollSegmentResponse)
+	err := c.cc.Invoke(ctx, Admin_RollSegment_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TruncateLog(ctx context.Context, in *TruncateLogRequest, opts ...grpc.CallOption) (*TruncateLogResponse, error) {
+	out := new(TruncateLogResponse)
+	err := c.cc.Invoke(ctx, Admin_TruncateLog_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeleteLog(ctx context.Context, in *DeleteLogRequest, opts ...grpc.CallOption) (*DeleteLogResponse, error) {
+	out := new(DeleteLogResponse)
+	err := c.cc.Invoke(ctx, Admin_DeleteLog_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) EnforceRetention(ctx context.Context, in *EnforceRetentionRequest, opts ...grpc.CallOption) (*EnforceRetentionResponse, error) {
+	out := new(EnforceRetentionResponse)
+	err := c.cc.Invoke(ctx, Admin_EnforceRetention_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	DescribeCluster(context.Context, *DescribeClusterRequest) (*DescribeClusterResponse, error)
+	Snapshot(*SnapshotRequest, Admin_SnapshotServer) error
+	// The log RPCs act on the log of the node that answers them, not the
+	// cluster's.
+	DescribeLog(context.Context, *DescribeLogRequest) (*DescribeLogResponse, error)
+	RollSegment(context.Context, *RollSegmentRequest) (*RollSegmentResponse, error)
+	TruncateLog(context.Context, *TruncateLogRequest) (*TruncateLogResponse, error)
+	// DeleteLog deletes the topic. There's a single log, so that's every
+	// record. Offsets carry on from where the log ended, so followers and
+	// consumers never see an offset reused for a different record.
+	DeleteLog(context.Context, *DeleteLogRequest) (*DeleteLogResponse, error)
+	// EnforceRetention removes the oldest segments the retention policy no
+	// longer keeps. Records have no keys, so there's nothing to compact and
+	// retention is the only cleanup.
+	EnforceRetention(context.Context, *EnforceRetentionRequest) (*EnforceRetentionResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) DescribeCluster(context.Context, *DescribeClusterRequest) (*DescribeClusterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeCluster not implemented")
+}
+func (UnimplementedAdminServer) Snapshot(*SnapshotRequest, Admin_SnapshotServer) error {
+	return status.Errorf(codes.Unimplemented, "method Snapshot not implemented")
+}
+func (UnimplementedAdminServer) DescribeLog(context.Context, *DescribeLogRequest) (*DescribeLogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeLog not implemented")
+}
+func (UnimplementedAdminServer) RollSegment(context.Context, *RollSegmentRequest) (*RollSegmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RollSegment not implemented")
+}
+func (UnimplementedAdminServer) TruncateLog(context.Context, *TruncateLogRequest) (*TruncateLogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TruncateLog not implemented")
+}
+func (UnimplementedAdminServer) DeleteLog(context.Context, *DeleteLogRequest) (*DeleteLogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLog not implemented")
+}
+func (UnimplementedAdminServer) EnforceRetention(context.Context, *EnforceRetentionRequest) (*EnforceRetentionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnforceRetention not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_DescribeCluster_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeClusterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DescribeCluster(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DescribeCluster_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DescribeCluster(ctx, req.(*DescribeClusterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Snapshot_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SnapshotRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdminServer).Snapshot(m, &adminSnapshotServer{stream})
+}
+
+type Admin_SnapshotServer interface {
+	Send(*SnapshotChunk) error
+	grpc.ServerStream
+}
+
+type adminSnapshotServer struct {
+	grpc.ServerStream
+}
+
+func (x *adminSnapshotServer) Send(m *SnapshotChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Admin_DescribeLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DescribeLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DescribeLog_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DescribeLog(ctx, req.(*DescribeLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RollSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RollSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RollSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RollSegment(ctx, req.(*RollSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_TruncateLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TruncateLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).TruncateLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_TruncateLog_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).TruncateLog(ctx, req.(*TruncateLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DeleteLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DeleteLog_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteLog(ctx, req.(*DeleteLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_EnforceRetention_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnforceRetentionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).EnforceRetention(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_EnforceRetention_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).EnforceRetention(ctx, req.(*EnforceRetentionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "log.v1.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "DescribeCluster",
+			Handler:    _Admin_DescribeCluster_Handler,
+		},
+		{
+			MethodName: "DescribeLog",
+			Handler:    _Admin_DescribeLog_Handler,
+		},
+		{
+			MethodName: "RollSegment",
+			Handler:    _Admin_RollSegment_Handler,
+		},
+		{
+			MethodName: "TruncateLog",
+			Handler:    _Admin_TruncateLog_Handler,
+		},
+		{
+			MethodName: "DeleteLog",
+			Handler:    _Admin_DeleteLog_Handler,
+		},
+		{
+			MethodName: "EnforceRetention",
+			Handler:    _Admin_EnforceRetention_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Snapshot",
+			Handler:       _Admin_Snapshot_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "api/v1/log.proto",
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/petrostrak/proglog/internal/config"
+)
+
+// gencert writes a CA plus server and client certificates for local
+// development and tests.
+func main() {
+	dir := flag.String(
+		"dir",
+		filepath.Dir(config.CAFile),
+		"directory to write the certificates to",
+	)
+	flag.Parse()
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := config.GenerateCerts(*dir); err != nil {
+		log.Fatal(err)
+	}
+
+	slog.Info("certificates written", "dir", *dir)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The formats records are read and written in.
+const (
+	// formatLines is a record per line, without the newline.
+	formatLines = "lines"
+	// formatLength is each record prefixed with its length as a uvarint,
+	// like protobuf's length-delimited messages.
+	formatLength = "length"
+	// formatJSON is a JSON object per line with the record's offset and
+	// base64-encoded value.
+	formatJSON = "json"
+	// formatRaw is each record's value followed by a newline.
+	formatRaw = "raw"
+)
+
+// produce appends each record read from stdin and prints its offset.
+func produce(ctx context.Context, cc *grpc.ClientConn, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("produce", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", formatLines, "how records are delimited on stdin: lines or length")
+	acks := fs.String("acks", "leader", "acknowledgements to wait for: leader, none or all")
+	output := fs.String("output", formatJSON, "how offsets are printed: json or raw")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	a, ok := api.Acks_value["ACKS_"+strings.ToUpper(*acks)]
+	if !ok {
+		return fmt.Errorf("unknown acks %q", *acks)
+	}
+
+	var next func() ([]byte, error)
+	r := bufio.NewReader(stdin)
+	switch *format {
+	case formatLines:
+		next = func() ([]byte, error) { return readLine(r) }
+	case formatLength:
+		next = func() ([]byte, error) { return readDelimited(r) }
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	w := bufio.NewWriter(stdout)
+	defer w.Flush()
+
+	client := api.NewLogClient(cc)
+	for {
+		value, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		res, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: value},
+			Acks:   api.Acks(a),
+		})
+		if err != nil {
+			return err
+		}
+
+		if api.Acks(a) == api.Acks_ACKS_NONE {
+			continue
+		}
+
+		switch *output {
+		case formatRaw:
+			_, err = fmt.Fprintln(w, res.Offset)
+		default:
+			err = json.NewEncoder(w).Encode(struct {
+				Offset uint64 `json:"offset"`
+			}{res.Offset})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readLine reads the next line, without its line ending. A final line
+// without a newline still counts.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	return bytes.TrimSuffix(line, []byte("\r")), nil
+}
+
+// readDelimited reads the next uvarint length-prefixed record.
+func readDelimited(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, n)
+	if _, err = io.ReadFull(r, value); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// consume prints the records from -from up to -to, or to the end of the log.
+func consume(ctx context.Context, cc *grpc.ClientConn, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("consume", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	from := fs.Uint64("from", 0, "offset of the first record")
+	to := fs.Uint64("to", 0, "offset to stop before, 0 for the end of the log")
+	output := fs.String("output", formatJSON, "how records are printed: json, raw or length")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	p, err := newPrinter(stdout, *output)
+	if err != nil {
+		return err
+	}
+	defer p.Flush()
+
+	client := api.NewLogClient(cc)
+	for off := *from; *to == 0 || off < *to; {
+		res, err := client.ConsumeRange(ctx, &api.ConsumeRangeRequest{
+			From:      off,
+			EndOffset: *to,
+		})
+		if err != nil {
+			return err
+		}
+
+		// An empty batch is the end of the log, which is only expected
+		// without -to.
+		if len(res.Records) == 0 {
+			if *to != 0 {
+				return api.ErrOffsetOutOfRange{Offset: off}
+			}
+			return nil
+		}
+
+		for _, record := range res.Records {
+			if err = p.print(record); err != nil {
+				return err
+			}
+		}
+		off = res.NextOffset
+	}
+
+	return nil
+}
+
+// tail prints records from -from onwards as they're appended, until
+// interrupted.
+func tail(ctx context.Context, cc *grpc.ClientConn, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	from := fs.Uint64("from", 0, "offset of the first record")
+	output := fs.String("output", formatJSON, "how records are printed: json, raw or length")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	p, err := newPrinter(stdout, *output)
+	if err != nil {
+		return err
+	}
+	defer p.Flush()
+
+	stream, err := api.NewLogClient(cc).ConsumeStream(ctx, &api.ConsumeRequest{Offset: *from})
+	if err != nil {
+		return err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if status.Code(err) == codes.Canceled || errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = p.print(res.Record); err != nil {
+			return err
+		}
+		// Tailed records are shown as they arrive.
+		if err = p.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// snapshot writes a snapshot of the server's log to stdout, a tar archive
+// that logdump restore can load into a stopped server's data directory.
+func snapshot(ctx context.Context, cc *grpc.ClientConn, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	stream, err := api.NewAdminClient(cc).Snapshot(ctx, &api.SnapshotRequest{})
+	if err != nil {
+		return err
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = stdout.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+}
+
+// printer writes records in one of the output formats.
+type printer struct {
+	*bufio.Writer
+	format string
+}
+
+func newPrinter(w io.Writer, format string) (*printer, error) {
+	switch format {
+	case formatJSON, formatRaw, formatLength:
+	default:
+		return nil, fmt.Errorf("unknown output %q", format)
+	}
+
+	return &printer{Writer: bufio.NewWriter(w), format: format}, nil
+}
+
+func (p *printer) print(record *api.Record) error {
+	var err error
+	switch p.format {
+	case formatRaw:
+		_, err = fmt.Fprintf(p, "%s\n", record.Value)
+	case formatLength:
+		p.Write(binary.AppendUvarint(nil, uint64(len(record.Value))))
+		_, err = p.Write(record.Value)
+	default:
+		err = json.NewEncoder(p).Encode(struct {
+			Offset uint64 `json:"offset"`
+			Value  []byte `json:"value"`
+		}{record.Offset, record.Value})
+	}
+
+	return err
+}
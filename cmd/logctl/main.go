@@ -0,0 +1,130 @@
+// logctl produces records to, consumes records from, tails and backs up a
+// proglog server over gRPC.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/petrostrak/proglog/internal/auth"
+	"github.com/petrostrak/proglog/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const usage = `Usage: logctl [flags] <command> [command flags]
+
+Commands:
+  produce  append records read from stdin
+  consume  print a range of records
+  tail     print records as they're appended
+  snapshot write a snapshot of the server's log to stdout
+
+Run logctl <command> -h for a command's flags.
+
+Flags:
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		slog.Error("logctl failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command in args, reading records from stdin and writing
+// output to stdout.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("logctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	addr := fs.String("addr", "localhost:8400", "gRPC address of the server")
+	caFile := fs.String("ca-file", config.CAFile, "CA to verify the server's certificate against")
+	certFile := fs.String("cert-file", config.ClientCertFile, "client certificate, skipped if the default doesn't exist")
+	keyFile := fs.String("key-file", config.ClientKeyFile, "client certificate's key")
+	plaintext := fs.Bool("insecure", false, "connect without TLS")
+	token := fs.String("token", os.Getenv("PROGLOG_TOKEN"), "bearer token or API key, defaults to $PROGLOG_TOKEN")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	var cmd func(context.Context, *grpc.ClientConn, []string, io.Reader, io.Writer, io.Writer) error
+	switch name := fs.Arg(0); name {
+	case "produce":
+		cmd = produce
+	case "consume":
+		cmd = consume
+	case "tail":
+		cmd = tail
+	case "snapshot":
+		cmd = snapshot
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	// The default client certificate is only used if it's there, so token
+	// users don't have to turn it off.
+	if !set["cert-file"] && !exists(*certFile) {
+		*certFile, *keyFile = "", ""
+	}
+
+	creds := insecure.NewCredentials()
+	if !*plaintext {
+		tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+			CertFile: *certFile,
+			KeyFile:  *keyFile,
+			CAFile:   *caFile,
+		})
+		if err != nil {
+			return err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if *token != "" {
+		if *plaintext {
+			return errors.New("tokens are only sent over TLS")
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(auth.TokenCredentials(*token)))
+	}
+
+	cc, err := grpc.NewClient(*addr, opts...)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	return cmd(ctx, cc, fs.Args()[1:], stdin, stdout, stderr)
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/petrostrak/proglog/internal/agent"
+	"github.com/petrostrak/proglog/internal/auth"
+	"github.com/petrostrak/proglog/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogctl(t *testing.T) {
+	dir := t.TempDir()
+	config.SetDir(dir)
+	require.NoError(t, config.GenerateCerts(dir))
+
+	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:           config.ServerCertFile,
+		KeyFile:            config.ServerKeyFile,
+		CAFile:             config.CAFile,
+		Server:             true,
+		ClientCertOptional: true,
+	})
+	require.NoError(t, err)
+
+	secret := "secret"
+	a, err := agent.New(agent.Config{
+		DataDir:         filepath.Join(dir, "data"),
+		RPCAddr:         "127.0.0.1:0",
+		ServerTLSConfig: serverTLSConfig,
+		TokenSecret:     secret,
+		ShutdownTimeout: time.Second,
+	})
+	require.NoError(t, err)
+	defer a.Shutdown()
+
+	ctx := context.Background()
+	logctl := func(ctx context.Context, stdin string, stdout io.Writer, args ...string) error {
+		args = append([]string{"-addr", a.RPCListenAddr()}, args...)
+		return run(ctx, args, strings.NewReader(stdin), stdout, io.Discard)
+	}
+
+	// The client certificate in the config directory is used by default.
+	var out bytes.Buffer
+	require.NoError(t, logctl(ctx, "first\nsecond\r\nthird", &out, "produce"))
+	require.Equal(t, "{\"offset\":0}\n{\"offset\":1}\n{\"offset\":2}\n", out.String())
+
+	var delimited []byte
+	for _, v := range []string{"fourth", ""} {
+		delimited = binary.AppendUvarint(delimited, uint64(len(v)))
+		delimited = append(delimited, v...)
+	}
+	out.Reset()
+	require.NoError(t, logctl(ctx, string(delimited), &out, "produce", "-format", "length", "-output", "raw"))
+	require.Equal(t, "3\n4\n", out.String())
+
+	out.Reset()
+	require.NoError(t, logctl(ctx, "", &out, "consume", "-output", "raw"))
+	require.Equal(t, "first\nsecond\nthird\nfourth\n\n", out.String())
+
+	out.Reset()
+	require.NoError(t, logctl(ctx, "", &out, "consume", "-from", "1", "-to", "2"))
+	require.Equal(t, "{\"offset\":1,\"value\":\"c2Vjb25k\"}\n", out.String())
+
+	require.Error(t, logctl(ctx, "", io.Discard, "consume", "-from", "4", "-to", "9"))
+
+	// A snapshot is a tar archive that starts with its manifest.
+	out.Reset()
+	require.NoError(t, logctl(ctx, "", &out, "snapshot"))
+	hdr, err := tar.NewReader(&out).Next()
+	require.NoError(t, err)
+	require.Equal(t, "manifest.json", hdr.Name)
+	require.Error(t, logctl(ctx, "", io.Discard, "bogus"))
+
+	// Tailing with a token instead of a certificate follows records
+	// appended after it starts.
+	token, err := auth.NewToken([]byte(secret), "root", time.Minute)
+	require.NoError(t, err)
+
+	tctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- logctl(tctx, "", pw, "-cert-file", "", "-token", token, "tail", "-from", "3", "-output", "raw")
+		pw.Close()
+	}()
+
+	lines := bufio.NewReader(pr)
+	line, err := lines.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "fourth\n", line)
+
+	require.NoError(t, logctl(ctx, "fifth\n", io.Discard, "produce"))
+	_, err = lines.ReadString('\n')
+	require.NoError(t, err)
+	line, err = lines.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "fifth\n", line)
+
+	cancel()
+	go io.Copy(io.Discard, pr)
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,298 @@
+// logdump inspects and verifies a log's segment files offline, without a
+// server. Only restore changes them.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/log"
+	"google.golang.org/protobuf/proto"
+)
+
+const usage = `Usage: logdump [flags] <command> [command flags]
+
+Commands:
+  list     print each segment's offsets, sizes and whether it verifies
+  index    print a segment's index entries
+  records  print a segment's records
+  verify   check every segment and exit non-zero if any are corrupt
+  restore  replace the log with a snapshot taken by logctl snapshot
+
+Run logdump <command> -h for a command's flags.
+
+Flags:
+`
+
+// errCorrupt is returned by verify when it finds problems.
+var errCorrupt = errors.New("log is corrupt")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		slog.Error("logdump failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command in args against the log in -dir.
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("logdump", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	dir := fs.String("dir", "data", "directory the log is stored in")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	var cmd func(string, []string, io.Writer, io.Writer) error
+	switch name := fs.Arg(0); name {
+	case "list":
+		cmd = list
+	case "index":
+		cmd = index
+	case "records":
+		cmd = records
+	case "verify":
+		cmd = verify
+	case "restore":
+		cmd = restore
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	return cmd(*dir, fs.Args()[1:], stdout, stderr)
+}
+
+// list prints a line per segment.
+func list(dir string, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	segments, err := log.ListSegments(dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BASE\tNEXT\tRECORDS\tENTRIES\tSTORE BYTES\tINDEX BYTES\tSTATUS")
+	for _, s := range segments {
+		rep := log.VerifySegment(s)
+
+		status := "ok"
+		if n := len(rep.Problems); n > 0 {
+			status = fmt.Sprintf("%d problems", n)
+		}
+
+		fmt.Fprintf(
+			w,
+			"%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			s.BaseOffset,
+			rep.NextOffset,
+			rep.Records,
+			rep.Entries,
+			size(s.StorePath),
+			size(s.IndexPath),
+			status,
+		)
+	}
+
+	return w.Flush()
+}
+
+// size returns the size of the file at path, or "-" if it's missing.
+func size(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "-"
+	}
+
+	return fmt.Sprint(fi.Size())
+}
+
+// index prints the index entries of the segment with base offset -segment.
+func index(dir string, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	base := fs.Uint64("segment", 0, "base offset of the segment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	s, err := findSegment(dir, *base)
+	if err != nil {
+		return err
+	}
+	if s.IndexPath == "" {
+		return fmt.Errorf("segment %d has no index", *base)
+	}
+
+	entries, err := log.ReadIndex(s.IndexPath)
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "RELATIVE\tOFFSET\tPOSITION")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%d\t%d\n", e.Offset, s.BaseOffset+uint64(e.Offset), e.Pos)
+	}
+
+	return errors.Join(w.Flush(), err)
+}
+
+// records prints the records in the store of the segment with base offset
+// -segment, as the store has them.
+func records(dir string, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("records", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	base := fs.Uint64("segment", 0, "base offset of the segment")
+	output := fs.String("output", "json", "how records are printed: json or raw")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *output != "json" && *output != "raw" {
+		return fmt.Errorf("unknown output %q", *output)
+	}
+
+	s, err := findSegment(dir, *base)
+	if err != nil {
+		return err
+	}
+	if s.StorePath == "" {
+		return fmt.Errorf("segment %d has no store", *base)
+	}
+
+	enc := json.NewEncoder(stdout)
+	return log.ScanStore(s.StorePath, func(pos uint64, p []byte) error {
+		record := &api.Record{}
+		if err := proto.Unmarshal(p, record); err != nil {
+			return fmt.Errorf("record at position %d: %w", pos, err)
+		}
+
+		if *output == "raw" {
+			_, err := fmt.Fprintf(stdout, "%s\n", record.Value)
+			return err
+		}
+
+		return enc.Encode(struct {
+			Offset   uint64 `json:"offset"`
+			Position uint64 `json:"position"`
+			Value    []byte `json:"value"`
+		}{record.Offset, pos, record.Value})
+	})
+}
+
+// findSegment returns the files of the segment with the given base offset.
+func findSegment(dir string, base uint64) (log.SegmentFiles, error) {
+	segments, err := log.ListSegments(dir)
+	if err != nil {
+		return log.SegmentFiles{}, err
+	}
+
+	for _, s := range segments {
+		if s.BaseOffset == base {
+			return s, nil
+		}
+	}
+
+	return log.SegmentFiles{}, fmt.Errorf("no segment with base offset %d in %s", base, dir)
+}
+
+// verify prints every problem found in the log and returns errCorrupt if
+// there are any.
+func verify(dir string, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rep, err := log.Verify(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range rep.Segments {
+		for _, p := range s.Problems {
+			fmt.Fprintf(stdout, "segment %d: %s\n", s.BaseOffset, p)
+		}
+	}
+	for _, p := range rep.Problems {
+		fmt.Fprintln(stdout, p)
+	}
+
+	if !rep.OK() {
+		return errCorrupt
+	}
+
+	fmt.Fprintf(stdout, "%d segments ok\n", len(rep.Segments))
+	return nil
+}
+
+// restore replaces the log in dir with the snapshot in -from. The server
+// mustn't be running, and the segment limits have to match its flags.
+func restore(dir string, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	from := fs.String("from", "", "snapshot file to restore")
+	c := log.Config{}
+	fs.Uint64Var(&c.Segment.MaxStoreBytes, "max-store-bytes", 0, "the server's -max-store-bytes")
+	fs.Uint64Var(&c.Segment.MaxIndexBytes, "max-index-bytes", 0, "the server's -max-index-bytes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == "" {
+		return errors.New("restore needs a snapshot file, -from")
+	}
+
+	f, err := os.Open(*from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	l, err := log.NewLog(dir, c)
+	if err != nil {
+		return err
+	}
+
+	if err = l.Restore(f); err != nil {
+		return errors.Join(err, l.Close())
+	}
+
+	segments := l.Segments()
+	fmt.Fprintf(
+		stdout,
+		"restored %d segments, offsets %d to %d\n",
+		len(segments),
+		segments[0].BaseOffset,
+		segments[len(segments)-1].NextOffset,
+	)
+
+	return l.Close()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogdump(t *testing.T) {
+	dir := t.TempDir()
+
+	c := log.Config{}
+	c.Segment.MaxStoreBytes = 32
+	l, err := log.NewLog(dir, c)
+	require.NoError(t, err)
+	for _, v := range []string{"foo", "bar", "baz", "qux", "quux"} {
+		_, err = l.Append(&api.Record{Value: []byte(v)})
+		require.NoError(t, err)
+	}
+	require.NoError(t, l.Close())
+
+	logdump := func(args ...string) (string, error) {
+		var stdout, stderr bytes.Buffer
+		err := run(append([]string{"-dir", dir}, args...), &stdout, &stderr)
+		return stdout.String(), err
+	}
+
+	out, err := logdump("verify")
+	require.NoError(t, err)
+	require.Contains(t, out, "segments ok")
+
+	out, err = logdump("list")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Greater(t, len(lines), 2)
+	require.Equal(t, []string{"0", "3", "3", "3"}, strings.Fields(lines[1])[:4])
+
+	out, err = logdump("index", "-segment", "0")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "1", "13"}, strings.Fields(strings.Split(out, "\n")[2]))
+
+	out, err = logdump("records", "-segment", "3")
+	require.NoError(t, err)
+	var record struct {
+		Offset uint64 `json:"offset"`
+		Value  []byte `json:"value"`
+	}
+	require.NoError(t, json.NewDecoder(strings.NewReader(out)).Decode(&record))
+	require.Equal(t, uint64(3), record.Offset)
+	require.Equal(t, []byte("qux"), record.Value)
+
+	out, err = logdump("records", "-segment", "0", "-output", "raw")
+	require.NoError(t, err)
+	require.Equal(t, "foo\nbar\nbaz\n", out)
+
+	// Index entries that point past the store's records are reported.
+	index := filepath.Join(dir, "3.index")
+	f, err := os.OpenFile(index, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.Write(make([]byte, 24))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	out, err = logdump("verify")
+	require.ErrorIs(t, err, errCorrupt)
+	require.Contains(t, out, "segment 3: index has 2 entries past the store's 2 records")
+
+	_, err = logdump("index", "-segment", "7")
+	require.Error(t, err)
+}
+
+func TestLogdumpRestore(t *testing.T) {
+	dir := t.TempDir()
+
+	c := log.Config{}
+	c.Segment.MaxStoreBytes = 32
+	l, err := log.NewLog(t.TempDir(), c)
+	require.NoError(t, err)
+	for _, v := range []string{"foo", "bar", "baz"} {
+		_, err = l.Append(&api.Record{Value: []byte(v)})
+		require.NoError(t, err)
+	}
+
+	snapshot := filepath.Join(dir, "snapshot.tar")
+	f, err := os.Create(snapshot)
+	require.NoError(t, err)
+	require.NoError(t, l.Snapshot(f))
+	require.NoError(t, f.Close())
+	require.NoError(t, l.Close())
+
+	data := filepath.Join(dir, "data")
+	var stdout bytes.Buffer
+	err = run([]string{"-dir", data, "restore", "-from", snapshot}, &stdout, io.Discard)
+	require.NoError(t, err)
+	require.Equal(t, "restored 2 segments, offsets 0 to 3\n", stdout.String())
+
+	stdout.Reset()
+	require.NoError(t, run([]string{"-dir", data, "records", "-segment", "0", "-output", "raw"}, &stdout, io.Discard))
+	require.Equal(t, "foo\nbar\nbaz\n", stdout.String())
+
+	err = run([]string{"-dir", data, "restore"}, io.Discard, io.Discard)
+	require.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/petrostrak/proglog/internal/agent"
+	"github.com/petrostrak/proglog/internal/config"
+	"github.com/petrostrak/proglog/internal/metrics"
+)
+
+// envPrefix prefixes the environment variable for each flag, so -data-dir
+// can be set with PROGLOG_DATA_DIR.
+const envPrefix = "PROGLOG_"
+
+// parseConfig builds the agent's config from args, the environment and the
+// JSON config file named by -config, in that order of precedence. The file
+// is an object keyed by flag name, such as {"data-dir": "/var/lib/proglog"}.
+func parseConfig(args []string, output io.Writer) (agent.Config, error) {
+	var (
+		cfg       agent.Config
+		serverTLS config.TLSConfig
+		peerTLS   config.TLSConfig
+	)
+
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	configFile := fs.String("config", "", "JSON file to read flags from")
+	fs.StringVar(&cfg.DataDir, "data-dir", "data", "directory to store the log in")
+	fs.Uint64Var(&cfg.MaxStoreBytes, "max-store-bytes", 0, "largest a segment's store may grow, 0 for the default")
+	fs.Uint64Var(&cfg.MaxIndexBytes, "max-index-bytes", 0, "largest a segment's index may grow, 0 for the default")
+	fs.Uint64Var(&cfg.RetentionBytes, "retention-bytes", 0, "size past which EnforceRetention removes the oldest segments, 0 for no limit")
+	fs.DurationVar(&cfg.RetentionAge, "retention-age", 0, "age past which EnforceRetention removes segments, 0 for no limit")
+	fs.StringVar(&cfg.NodeName, "node-name", "", "name of this server, defaults to the host name")
+	fs.StringVar(&cfg.RPCAddr, "rpc-addr", ":8400", "address to serve gRPC on")
+	fs.StringVar(&cfg.HTTPAddr, "http-addr", ":3000", "address to serve HTTP on, empty to disable")
+	fs.StringVar(&cfg.LeaderAddr, "leader-addr", "", "gRPC address of the leader to replicate from, empty to lead")
+	fs.StringVar(&serverTLS.CertFile, "server-tls-cert-file", "", "server certificate")
+	fs.StringVar(&serverTLS.KeyFile, "server-tls-key-file", "", "server certificate's key")
+	fs.StringVar(&serverTLS.CAFile, "server-tls-ca-file", "", "CA that client certificates are verified against")
+	fs.StringVar(&peerTLS.CertFile, "peer-tls-cert-file", "", "certificate to present to the leader")
+	fs.StringVar(&peerTLS.KeyFile, "peer-tls-key-file", "", "key of the certificate presented to the leader")
+	fs.StringVar(&peerTLS.CAFile, "peer-tls-ca-file", "", "CA that the leader's certificate is verified against")
+	reloadInterval := fs.Duration("tls-reload-interval", time.Minute, "how often to check the TLS files for rotated certificates, 0 to never reload them")
+	fs.StringVar(&cfg.ACLPolicyFile, "acl-policy-file", "", "ACL policy to authorize calls against, empty to allow everything")
+	fs.StringVar(&cfg.TokenSecret, "token-secret", "", "secret bearer tokens are signed with")
+	fs.StringVar(&cfg.APIKeysFile, "api-keys-file", "", "file of API keys and their subjects")
+	websocketOrigins := fs.String("websocket-origins", "", "comma-separated origins, such as https://app.example.com, whose pages may open WebSockets besides the server's own")
+	enableMetrics := fs.Bool("metrics", true, "serve Prometheus metrics at /metrics")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 0, "how long to wait for calls to finish on shutdown, 0 for the default")
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if fs.NArg() > 0 {
+		return cfg, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if *configFile == "" {
+		*configFile = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	file, err := readConfigFile(*configFile)
+	if err != nil {
+		return cfg, err
+	}
+
+	var unknown []string
+	for name := range file {
+		if fs.Lookup(name) == nil || name == "config" {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return cfg, fmt.Errorf("%s: unknown settings %v", *configFile, unknown)
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || f.Name == "config" {
+			return
+		}
+
+		env := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(env); ok {
+			if err := fs.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", env, err))
+			}
+			return
+		}
+
+		if v, ok := file[f.Name]; ok {
+			if err := fs.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", *configFile, f.Name, err))
+			}
+		}
+	})
+	if err = errors.Join(errs...); err != nil {
+		return cfg, err
+	}
+
+	for _, origin := range strings.Split(*websocketOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.WebSocketOrigins = append(cfg.WebSocketOrigins, origin)
+		}
+	}
+
+	if *enableMetrics {
+		cfg.Metrics = metrics.NewRegistry()
+	}
+
+	if serverTLS.CertFile != "" || serverTLS.KeyFile != "" {
+		serverTLS.Server = true
+		// Clients that authenticate with a token or API key don't need a
+		// certificate.
+		serverTLS.ClientCertOptional = cfg.TokenSecret != "" || cfg.APIKeysFile != ""
+		if *reloadInterval > 0 {
+			cfg.ServerTLSReloader, err = config.NewTLSReloader(serverTLS, *reloadInterval)
+		} else {
+			cfg.ServerTLSConfig, err = config.SetupTLSConfig(serverTLS)
+		}
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	if cfg.LeaderAddr != "" && (peerTLS.CertFile != "" || peerTLS.CAFile != "") {
+		peerTLS.ServerAddress, _, err = net.SplitHostPort(cfg.LeaderAddr)
+		if err == nil {
+			if *reloadInterval > 0 {
+				cfg.PeerTLSReloader, err = config.NewTLSReloader(peerTLS, *reloadInterval)
+			} else {
+				cfg.PeerTLSConfig, err = config.SetupTLSConfig(peerTLS)
+			}
+		}
+		if err != nil {
+			// The agent closes the server's reloader, but it won't run.
+			if cfg.ServerTLSReloader != nil {
+				cfg.ServerTLSReloader.Close()
+			}
+			return cfg, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// readConfigFile reads the JSON config file at name, if there is one, with
+// each value formatted as it would be on the command line.
+func readConfigFile(name string) (map[string]string, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	file := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			file[k] = s
+			continue
+		}
+		// Numbers and booleans are set from their JSON text.
+		file[k] = string(v)
+	}
+
+	return file, nil
+}
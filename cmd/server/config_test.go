@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/petrostrak/proglog/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseConfig tests that flags win over the environment, which wins over
+// the config file, which wins over the defaults.
+func TestParseConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "server.json")
+	err := os.WriteFile(file, []byte(`{
+		"data-dir": "from-file",
+		"rpc-addr": "from-file:1",
+		"http-addr": "from-file:2",
+		"max-store-bytes": 1024,
+		"metrics": false,
+		"shutdown-timeout": "5s",
+		"websocket-origins": "https://a.example.com, https://b.example.com"
+	}`), 0644)
+	require.NoError(t, err)
+
+	t.Setenv("PROGLOG_CONFIG", file)
+	t.Setenv("PROGLOG_RPC_ADDR", "from-env:1")
+	t.Setenv("PROGLOG_HTTP_ADDR", "from-env:2")
+
+	cfg, err := parseConfig([]string{"-http-addr", "from-flag:2"}, io.Discard)
+	require.NoError(t, err)
+
+	require.Equal(t, "from-file", cfg.DataDir)
+	require.Equal(t, uint64(1024), cfg.MaxStoreBytes)
+	require.Equal(t, "from-env:1", cfg.RPCAddr)
+	require.Equal(t, "from-flag:2", cfg.HTTPAddr)
+	require.Equal(t, 5*time.Second, cfg.ShutdownTimeout)
+	require.Nil(t, cfg.Metrics)
+	require.Zero(t, cfg.MaxIndexBytes)
+	require.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, cfg.WebSocketOrigins)
+
+	err = os.WriteFile(file, []byte(`{"data_dir": "typo"}`), 0644)
+	require.NoError(t, err)
+	_, err = parseConfig(nil, io.Discard)
+	require.ErrorContains(t, err, "unknown settings")
+
+	t.Setenv("PROGLOG_CONFIG", "")
+	t.Setenv("PROGLOG_MAX_STORE_BYTES", "lots")
+	_, err = parseConfig(nil, io.Discard)
+	require.ErrorContains(t, err, "PROGLOG_MAX_STORE_BYTES")
+}
+
+// TestParseConfigTLS tests that TLS files are reloaded unless reloading is
+// turned off.
+func TestParseConfigTLS(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, config.GenerateCerts(dir))
+
+	args := []string{
+		"-server-tls-cert-file", filepath.Join(dir, "server.pem"),
+		"-server-tls-key-file", filepath.Join(dir, "server-key.pem"),
+		"-server-tls-ca-file", filepath.Join(dir, "ca.pem"),
+		"-leader-addr", "127.0.0.1:8400",
+		"-peer-tls-cert-file", filepath.Join(dir, "client.pem"),
+		"-peer-tls-key-file", filepath.Join(dir, "client-key.pem"),
+		"-peer-tls-ca-file", filepath.Join(dir, "ca.pem"),
+	}
+
+	cfg, err := parseConfig(args, io.Discard)
+	require.NoError(t, err)
+	defer cfg.ServerTLSReloader.Close()
+	defer cfg.PeerTLSReloader.Close()
+	require.NotNil(t, cfg.ServerTLSReloader.Config())
+	require.NotNil(t, cfg.PeerTLSReloader.Config())
+	require.Nil(t, cfg.ServerTLSConfig)
+	require.Nil(t, cfg.PeerTLSConfig)
+
+	cfg, err = parseConfig(append(args, "-tls-reload-interval", "0"), io.Discard)
+	require.NoError(t, err)
+	require.Nil(t, cfg.ServerTLSReloader)
+	require.Nil(t, cfg.PeerTLSReloader)
+	require.NotNil(t, cfg.ServerTLSConfig)
+	require.NotNil(t, cfg.PeerTLSConfig)
+}
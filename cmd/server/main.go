@@ -1,14 +1,63 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
 	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/petrostrak/proglog/internal/server"
+	"github.com/petrostrak/proglog/internal/agent"
 )
 
 func main() {
-	srv := server.NewHTTPServer(":3000")
-	slog.Info("server running on", "port", srv.Addr)
-	log.Fatal(srv.ListenAndServe())
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		slog.Error("server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run serves the log until SIGINT or SIGTERM, then shuts down gracefully:
+// produces are refused, streams end, calls in flight finish and the log is
+// closed.
+func run(args []string) error {
+	cfg, err := parseConfig(args, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	a, err := agent.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	slog.Info(
+		"server running",
+		"rpc_addr", a.RPCListenAddr(),
+		"http_addr", a.HTTPListenAddr(),
+		"data_dir", cfg.DataDir,
+		"leader_addr", cfg.LeaderAddr,
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	case <-a.Done():
+		return errors.New("server stopped unexpectedly")
+	}
+
+	if err = a.Shutdown(); err != nil {
+		return err
+	}
+
+	slog.Info("server stopped")
+	return nil
 }
@@ -0,0 +1,378 @@
+// Package agent runs a proglog server: it opens the log, replicating it from
+// a leader if there is one, serves it over gRPC and HTTP, and shuts
+// everything down in order.
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/petrostrak/proglog/internal/auth"
+	"github.com/petrostrak/proglog/internal/config"
+	"github.com/petrostrak/proglog/internal/log"
+	"github.com/petrostrak/proglog/internal/metrics"
+	"github.com/petrostrak/proglog/internal/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Config is everything the agent needs to run a server.
+type Config struct {
+	// DataDir is where the log keeps its segments.
+	DataDir string
+	// MaxStoreBytes and MaxIndexBytes cap each segment's files. Zero uses
+	// the log's defaults.
+	MaxStoreBytes uint64
+	MaxIndexBytes uint64
+	// RetentionBytes and RetentionAge are the log's retention policy,
+	// applied when an operator calls EnforceRetention. Zero keeps
+	// everything.
+	RetentionBytes uint64
+	RetentionAge   time.Duration
+	// NodeName identifies the server to its leader and in GetServers
+	// responses. It defaults to the host name.
+	NodeName string
+	// RPCAddr and HTTPAddr are the addresses the gRPC and HTTP servers
+	// listen on. An empty HTTPAddr disables the HTTP server.
+	RPCAddr  string
+	HTTPAddr string
+	// LeaderAddr, if set, makes the server a follower that replicates from
+	// the leader's gRPC address. Otherwise the server leads its own log.
+	LeaderAddr string
+	// ServerTLSConfig secures both servers and PeerTLSConfig secures the
+	// connection to the leader. Nil configs disable TLS.
+	ServerTLSConfig *tls.Config
+	PeerTLSConfig   *tls.Config
+	// ServerTLSReloader and PeerTLSReloader, if set, take the place of
+	// ServerTLSConfig and PeerTLSConfig, so rotated certificates are used
+	// without a restart. Shutdown closes them.
+	ServerTLSReloader *config.TLSReloader
+	PeerTLSReloader   *config.TLSReloader
+	// ACLPolicyFile, if set, is the policy calls are authorized against.
+	// Without one every call is allowed.
+	ACLPolicyFile string
+	// TokenSecret and APIKeysFile, if set, let clients authenticate with
+	// bearer tokens and API keys instead of client certificates.
+	TokenSecret string
+	APIKeysFile string
+	// WebSocketOrigins are the origins besides the server's own whose
+	// pages may open WebSockets.
+	WebSocketOrigins []string
+	// Metrics, if set, is where the log and servers report metrics.
+	Metrics *metrics.Registry
+	// Logger writes the access log. It defaults to slog.Default().
+	Logger *slog.Logger
+	// ShutdownTimeout is how long Shutdown waits for calls to finish before
+	// cutting them off. It defaults to 10s.
+	ShutdownTimeout time.Duration
+}
+
+// commitLog is the log the agent runs, a *log.Leader or *log.Follower.
+type commitLog interface {
+	server.CommitLog
+	Close() error
+}
+
+// Agent runs a server until Shutdown is called.
+type Agent struct {
+	Config
+
+	log        commitLog
+	leaderConn *grpc.ClientConn
+	serverCfg  *server.Config
+	grpcServer *grpc.Server
+	httpServer *http.Server
+	grpcLn     net.Listener
+	httpLn     net.Listener
+
+	shutdown     bool
+	shutdownLock sync.Mutex
+	done         chan struct{}
+}
+
+// New opens the log and starts the servers.
+func New(config Config) (*Agent, error) {
+	a := &Agent{
+		Config: config,
+		done:   make(chan struct{}),
+	}
+
+	if a.ServerTLSReloader != nil {
+		a.ServerTLSConfig = a.ServerTLSReloader.Config()
+	}
+	if a.PeerTLSReloader != nil {
+		a.PeerTLSConfig = a.PeerTLSReloader.Config()
+	}
+
+	setup := []func() error{
+		a.setupListeners,
+		a.setupLog,
+		a.setupServers,
+	}
+	for _, fn := range setup {
+		if err := fn(); err != nil {
+			a.close()
+			return nil, err
+		}
+	}
+
+	go a.serve()
+
+	return a, nil
+}
+
+// setupListeners opens the gRPC and HTTP ports. They can't share one
+// through a Mux: it tells connections apart by their first byte, and gRPC
+// and HTTPS connections both start with a TLS handshake. Serving gRPC from
+// the HTTP server instead would swap grpc-go's transport for net/http's,
+// which doesn't support all of gRPC's features.
+func (a *Agent) setupListeners() error {
+	var err error
+	a.grpcLn, err = net.Listen("tcp", a.RPCAddr)
+	if err != nil {
+		return err
+	}
+
+	if a.HTTPAddr == "" {
+		return nil
+	}
+
+	a.httpLn, err = net.Listen("tcp", a.HTTPAddr)
+	return err
+}
+
+func (a *Agent) setupLog() error {
+	if a.NodeName == "" {
+		name, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		a.NodeName = name
+	}
+
+	if err := os.MkdirAll(a.DataDir, 0755); err != nil {
+		return err
+	}
+
+	c := log.Config{Metrics: a.Metrics}
+	c.Segment.MaxStoreBytes = a.MaxStoreBytes
+	c.Segment.MaxIndexBytes = a.MaxIndexBytes
+	c.Retention.MaxBytes = a.RetentionBytes
+	c.Retention.MaxAge = a.RetentionAge
+
+	if a.LeaderAddr == "" {
+		leader, err := log.NewLeader(a.DataDir, c)
+		if err != nil {
+			return err
+		}
+		a.log = leader
+		return nil
+	}
+
+	creds := insecure.NewCredentials()
+	if a.PeerTLSConfig != nil {
+		creds = credentials.NewTLS(a.PeerTLSConfig)
+	}
+
+	var err error
+	a.leaderConn, err = grpc.NewClient(a.LeaderAddr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+
+	follower, err := log.NewFollower(a.DataDir, c, a.NodeName, a.leaderConn)
+	if err != nil {
+		return err
+	}
+	a.log = follower
+
+	return nil
+}
+
+func (a *Agent) setupServers() error {
+	a.serverCfg = &server.Config{
+		CommitLog:        a.log,
+		ServerID:         a.NodeName,
+		RPCAddr:          a.grpcLn.Addr().String(),
+		Logger:           a.Logger,
+		Metrics:          a.Metrics,
+		WebSocketOrigins: a.WebSocketOrigins,
+	}
+
+	if a.ACLPolicyFile != "" {
+		authorizer, err := auth.New(a.ACLPolicyFile)
+		if err != nil {
+			return err
+		}
+		a.serverCfg.Authorizer = authorizer
+	}
+
+	var authenticators auth.Authenticators
+	if a.TokenSecret != "" {
+		authenticators = append(authenticators, auth.NewTokenAuthenticator([]byte(a.TokenSecret)))
+	}
+	if a.APIKeysFile != "" {
+		keys, err := auth.NewAPIKeyAuthenticator(a.APIKeysFile)
+		if err != nil {
+			return err
+		}
+		authenticators = append(authenticators, keys)
+	}
+	if len(authenticators) > 0 {
+		a.serverCfg.Authenticator = authenticators
+	}
+
+	var opts []grpc.ServerOption
+	if a.ServerTLSConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(a.ServerTLSConfig)))
+	}
+
+	var err error
+	a.grpcServer, err = server.NewGRPCServer(a.serverCfg, opts...)
+	if err != nil {
+		return err
+	}
+
+	if a.httpLn != nil {
+		a.httpServer = server.NewHTTPServer(a.HTTPAddr, a.serverCfg)
+		a.httpServer.TLSConfig = a.ServerTLSConfig
+	}
+
+	return nil
+}
+
+// serve runs the servers, shutting the agent down if either fails.
+func (a *Agent) serve() {
+	go func() {
+		if err := a.grpcServer.Serve(a.grpcLn); err != nil {
+			slog.Error("grpc server failed", "error", err)
+			a.Shutdown()
+		}
+	}()
+
+	if a.httpServer == nil {
+		return
+	}
+
+	var err error
+	if a.httpServer.TLSConfig != nil {
+		err = a.httpServer.ServeTLS(a.httpLn, "", "")
+	} else {
+		err = a.httpServer.Serve(a.httpLn)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("http server failed", "error", err)
+		a.Shutdown()
+	}
+}
+
+// RPCListenAddr returns the address the gRPC server listens on, which
+// differs from RPCAddr if that asked for any free port.
+func (a *Agent) RPCListenAddr() string {
+	return a.grpcLn.Addr().String()
+}
+
+// HTTPListenAddr returns the address the HTTP server listens on, or "" if
+// there's no HTTP server.
+func (a *Agent) HTTPListenAddr() string {
+	if a.httpLn == nil {
+		return ""
+	}
+
+	return a.httpLn.Addr().String()
+}
+
+// Done returns a channel that's closed once the agent has shut down, whether
+// Shutdown was called or a server failed.
+func (a *Agent) Done() <-chan struct{} {
+	return a.done
+}
+
+// Shutdown stops the agent. The servers stop accepting produces and end
+// their streams, then wait up to ShutdownTimeout for calls in flight before
+// stopping. Only then is the log closed, so its indexes are truncated to the
+// records that were written.
+func (a *Agent) Shutdown() error {
+	a.shutdownLock.Lock()
+	defer a.shutdownLock.Unlock()
+
+	if a.shutdown {
+		return nil
+	}
+	a.shutdown = true
+
+	a.serverCfg.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout())
+	defer cancel()
+
+	var errs []error
+	if a.httpServer != nil {
+		if err := a.httpServer.Shutdown(ctx); err != nil {
+			errs = append(errs, err, a.httpServer.Close())
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		a.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		a.grpcServer.Stop()
+		<-stopped
+	}
+
+	errs = append(errs, a.close())
+	close(a.done)
+
+	return errors.Join(errs...)
+}
+
+// close closes the log, then the connection to the leader, the listeners
+// and the TLS reloaders, whichever have been set up.
+func (a *Agent) close() error {
+	var errs []error
+	if a.log != nil {
+		errs = append(errs, a.log.Close())
+	}
+
+	if a.leaderConn != nil {
+		errs = append(errs, a.leaderConn.Close())
+	}
+
+	for _, r := range []*config.TLSReloader{a.ServerTLSReloader, a.PeerTLSReloader} {
+		if r != nil {
+			errs = append(errs, r.Close())
+		}
+	}
+
+	for _, ln := range []net.Listener{a.grpcLn, a.httpLn} {
+		if ln == nil {
+			continue
+		}
+		if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a *Agent) shutdownTimeout() time.Duration {
+	if a.ShutdownTimeout == 0 {
+		return 10 * time.Second
+	}
+
+	return a.ShutdownTimeout
+}
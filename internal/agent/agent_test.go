@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/config"
+	"github.com/petrostrak/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func TestAgent(t *testing.T) {
+	certDir := t.TempDir()
+	config.SetDir(certDir)
+	require.NoError(t, config.GenerateCerts(certDir))
+
+	policy, err := os.ReadFile(filepath.Join("..", "..", "test", "policy.csv"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(config.ACLPolicyFile, policy, 0644))
+
+	serverTLS, err := config.NewTLSReloader(config.TLSConfig{
+		CertFile:      config.ServerCertFile,
+		KeyFile:       config.ServerKeyFile,
+		CAFile:        config.CAFile,
+		Server:        true,
+		ServerAddress: "127.0.0.1",
+	}, time.Minute)
+	require.NoError(t, err)
+
+	peerFiles := config.TLSConfig{
+		CertFile:      config.RootClientCertFile,
+		KeyFile:       config.RootClientKeyFile,
+		CAFile:        config.CAFile,
+		ServerAddress: "127.0.0.1",
+	}
+	peerTLS, err := config.NewTLSReloader(peerFiles, time.Minute)
+	require.NoError(t, err)
+
+	peerTLSConfig, err := config.SetupTLSConfig(peerFiles)
+	require.NoError(t, err)
+
+	newAgent := func(name, leaderAddr string) *Agent {
+		a, err := New(Config{
+			DataDir:           filepath.Join(t.TempDir(), name),
+			NodeName:          name,
+			RPCAddr:           "127.0.0.1:0",
+			HTTPAddr:          "127.0.0.1:0",
+			LeaderAddr:        leaderAddr,
+			ServerTLSReloader: serverTLS,
+			PeerTLSReloader:   peerTLS,
+			ACLPolicyFile:     config.ACLPolicyFile,
+			ShutdownTimeout:   time.Second,
+		})
+		require.NoError(t, err)
+		return a
+	}
+
+	leader := newAgent("leader", "")
+	follower := newAgent("follower", leader.RPCListenAddr())
+
+	client := func(a *Agent) api.LogClient {
+		cc, err := grpc.NewClient(
+			a.RPCListenAddr(),
+			grpc.WithTransportCredentials(credentials.NewTLS(peerTLSConfig)),
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { cc.Close() })
+		return api.NewLogClient(cc)
+	}
+
+	ctx := context.Background()
+	produce, err := client(leader).Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("foo")},
+		Acks:   api.Acks_ACKS_ALL,
+	})
+	require.NoError(t, err)
+
+	followerClient := client(follower)
+	require.Eventually(t, func() bool {
+		consume, err := followerClient.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+		return err == nil && string(consume.Record.Value) == "foo"
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// A stream that's following the log doesn't hold up the shutdown.
+	stream, err := client(leader).ConsumeStream(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	require.NoError(t, follower.Shutdown())
+	require.NoError(t, leader.Shutdown())
+	require.NoError(t, leader.Shutdown())
+	<-leader.Done()
+
+	// The log was closed cleanly, so it reopens where it left off.
+	l, err := log.NewLog(leader.DataDir, log.Config{})
+	require.NoError(t, err)
+	defer l.Close()
+
+	highest, err := l.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, produce.Offset, highest)
+
+	record, err := l.Read(produce.Offset)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foo"), record.Value)
+}
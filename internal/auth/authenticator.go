@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// The ways a principal can be authenticated.
+const (
+	MethodMTLS   = "mtls"
+	MethodToken  = "token"
+	MethodAPIKey = "apikey"
+)
+
+var (
+	ErrInvalidCredential = errors.New("invalid credential")
+	ErrExpiredToken      = errors.New("token has expired")
+)
+
+// Principal is an authenticated caller. Subject is what the Authorizer's
+// policy refers to, however the caller proved who they are.
+type Principal struct {
+	Subject string
+	Method  string
+}
+
+// Authenticator turns a credential presented as a bearer token into the
+// principal it belongs to.
+type Authenticator interface {
+	Authenticate(credential string) (Principal, error)
+}
+
+// Authenticators tries each authenticator in turn and returns the first
+// principal one of them accepts.
+type Authenticators []Authenticator
+
+func (as Authenticators) Authenticate(credential string) (Principal, error) {
+	for _, a := range as {
+		p, err := a.Authenticate(credential)
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, ErrInvalidCredential) {
+			return Principal{}, err
+		}
+	}
+
+	return Principal{}, ErrInvalidCredential
+}
+
+// TokenAuthenticator verifies JWTs signed with HMAC-SHA256 and a shared
+// secret. The token's sub claim becomes the principal's subject.
+type TokenAuthenticator struct {
+	secret []byte
+}
+
+func NewTokenAuthenticator(secret []byte) *TokenAuthenticator {
+	return &TokenAuthenticator{secret: secret}
+}
+
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+var tokenEncoding = base64.RawURLEncoding
+
+// NewToken signs a token for subject that's valid for ttl.
+func NewToken(secret []byte, subject string, ttl time.Duration) (string, error) {
+	h, err := json.Marshal(tokenHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	c, err := json.Marshal(tokenClaims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := tokenEncoding.EncodeToString(h) + "." + tokenEncoding.EncodeToString(c)
+
+	return signed + "." + tokenEncoding.EncodeToString(sign(secret, signed)), nil
+}
+
+func sign(secret []byte, signed string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func (a *TokenAuthenticator) Authenticate(credential string) (Principal, error) {
+	parts := strings.Split(credential, ".")
+	if len(parts) != 3 {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	b, err := tokenEncoding.DecodeString(parts[0])
+	if err != nil {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	// We only accept the algorithm we sign with, so a token can't choose a
+	// weaker one such as "none".
+	var h tokenHeader
+	if err = json.Unmarshal(b, &h); err != nil || h.Alg != "HS256" {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	sig, err := tokenEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	if !hmac.Equal(sig, sign(a.secret, parts[0]+"."+parts[1])) {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	b, err = tokenEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	var c tokenClaims
+	if err = json.Unmarshal(b, &c); err != nil || c.Subject == "" {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	now := time.Now().Unix()
+	if c.ExpiresAt != 0 && now >= c.ExpiresAt {
+		return Principal{}, ErrExpiredToken
+	}
+
+	if c.NotBefore != 0 && now < c.NotBefore {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	return Principal{Subject: c.Subject, Method: MethodToken}, nil
+}
+
+// APIKeyAuthenticator maps static API keys to subjects. It only keeps the
+// keys' hashes.
+type APIKeyAuthenticator struct {
+	subjects map[[sha256.Size]byte]string
+}
+
+// NewAPIKeyAuthenticator loads API keys from keysFile. Each line of the file
+// is a comma-separated key and subject, and lines starting with # are
+// comments.
+func NewAPIKeyAuthenticator(keysFile string) (*APIKeyAuthenticator, error) {
+	f, err := os.Open(keysFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+
+	a := &APIKeyAuthenticator{
+		subjects: make(map[[sha256.Size]byte]string),
+	}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse api keys %q: %w", keysFile, err)
+		}
+
+		a.subjects[sha256.Sum256([]byte(rec[0]))] = rec[1]
+	}
+
+	return a, nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(credential string) (Principal, error) {
+	subject, ok := a.subjects[sha256.Sum256([]byte(credential))]
+	if !ok {
+		return Principal{}, ErrInvalidCredential
+	}
+
+	return Principal{Subject: subject, Method: MethodAPIKey}, nil
+}
+
+// TokenCredentials sends a token or API key as a bearer token on every gRPC
+// call. It implements credentials.PerRPCCredentials.
+type TokenCredentials string
+
+func (t TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t TokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
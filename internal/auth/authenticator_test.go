@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	a := NewTokenAuthenticator(secret)
+
+	token, err := NewToken(secret, "root", time.Minute)
+	require.NoError(t, err)
+
+	p, err := a.Authenticate(token)
+	require.NoError(t, err)
+	require.Equal(t, Principal{Subject: "root", Method: MethodToken}, p)
+
+	// A token signed with another secret is rejected.
+	forged, err := NewToken([]byte("other"), "root", time.Minute)
+	require.NoError(t, err)
+	_, err = a.Authenticate(forged)
+	require.ErrorIs(t, err, ErrInvalidCredential)
+
+	// So is one that claims it needs no signature.
+	parts := strings.Split(token, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	_, err = a.Authenticate(none + "." + parts[1] + ".")
+	require.ErrorIs(t, err, ErrInvalidCredential)
+
+	expired, err := NewToken(secret, "root", -time.Minute)
+	require.NoError(t, err)
+	_, err = a.Authenticate(expired)
+	require.ErrorIs(t, err, ErrExpiredToken)
+
+	_, err = a.Authenticate("not-a-token")
+	require.ErrorIs(t, err, ErrInvalidCredential)
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	f, err := os.CreateTemp("", "apikeys_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`# key, subject
+k3y, root
+`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	keys, err := NewAPIKeyAuthenticator(f.Name())
+	require.NoError(t, err)
+
+	p, err := keys.Authenticate("k3y")
+	require.NoError(t, err)
+	require.Equal(t, Principal{Subject: "root", Method: MethodAPIKey}, p)
+
+	// Chained, a credential any authenticator accepts is valid.
+	a := Authenticators{NewTokenAuthenticator([]byte("secret")), keys}
+	p, err = a.Authenticate("k3y")
+	require.NoError(t, err)
+	require.Equal(t, "root", p.Subject)
+
+	_, err = a.Authenticate("wrong")
+	require.ErrorIs(t, err, ErrInvalidCredential)
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+
+	api "github.com/petrostrak/proglog/api/v1"
+)
+
+// Wildcard matches any subject, object or action in a policy rule.
+const Wildcard = "*"
+
+// rule permits subject to perform action on object.
+type rule struct {
+	subject string
+	object  string
+	action  string
+}
+
+func (r rule) matches(subject, object, action string) bool {
+	return match(r.subject, subject) &&
+		match(r.object, object) &&
+		match(r.action, action)
+}
+
+// match reports whether s matches pattern. Nothing matches an empty s, so
+// callers without a subject aren't covered by wildcard rules.
+func match(pattern, s string) bool {
+	if s == "" {
+		return false
+	}
+
+	return pattern == Wildcard || pattern == s
+}
+
+// Authorizer decides whether a subject may perform an action on an object
+// according to a policy file. Anything the policy doesn't permit is denied.
+type Authorizer struct {
+	rules []rule
+}
+
+// New loads the policy from policyFile. Each line of the file is a
+// comma-separated rule of subject, object and action, such as
+//
+//	root, default, produce
+//
+// Lines starting with # are comments.
+func New(policyFile string) (*Authorizer, error) {
+	f, err := os.Open(policyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+	r.TrimLeadingSpace = true
+
+	a := &Authorizer{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse policy %q: %w", policyFile, err)
+		}
+
+		a.rules = append(a.rules, rule{
+			subject: rec[0],
+			object:  rec[1],
+			action:  rec[2],
+		})
+	}
+
+	return a, nil
+}
+
+// Authorize returns nil if subject may perform action on object, and a
+// PermissionDenied error otherwise.
+func (a *Authorizer) Authorize(subject, object, action string) error {
+	for _, r := range a.rules {
+		if r.matches(subject, object, action) {
+			return nil
+		}
+	}
+
+	return api.ErrPermissionDenied{
+		Subject: subject,
+		Object:  object,
+		Action:  action,
+	}
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizer(t *testing.T) {
+	f, err := os.CreateTemp("", "policy_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`# subject, object, action
+root, *, produce
+root, *, consume
+admin, *, *
+*, *, describe
+`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	a, err := New(f.Name())
+	require.NoError(t, err)
+
+	require.NoError(t, a.Authorize("root", "*", "produce"))
+	require.NoError(t, a.Authorize("root", "topic", "consume"))
+	require.NoError(t, a.Authorize("admin", "*", "snapshot"))
+
+	err = a.Authorize("root", "*", "snapshot")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	err = a.Authorize("nobody", "*", "consume")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Wildcards don't cover callers without a subject.
+	err = a.Authorize("", "*", "snapshot")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
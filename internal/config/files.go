@@ -6,18 +6,42 @@ import (
 )
 
 // These variables define the paths to the certs we generated and need
-// to look up.
+// to look up. They point into CONFIG_DIR, or ~/.proglog if it isn't set.
 var (
-	CAFile         = configFile("ca.pem")
-	ServerCertFile = configFile("server.pem")
-	ServerKeyFile  = configFile("server-key.pem")
-	ClientCertFile = configFile("client.pem")
-	ClientKeyFile  = configFile("client-key.pem")
+	CAFile               string
+	ServerCertFile       string
+	ServerKeyFile        string
+	ClientCertFile       string
+	ClientKeyFile        string
+	RootClientCertFile   string
+	RootClientKeyFile    string
+	NobodyClientCertFile string
+	NobodyClientKeyFile  string
+	ACLPolicyFile        string
 )
 
-func configFile(filename string) string {
+func init() {
+	SetDir(configDir())
+}
+
+// SetDir points the file variables at dir, such as a directory that
+// GenerateCerts wrote to.
+func SetDir(dir string) {
+	CAFile = filepath.Join(dir, "ca.pem")
+	ServerCertFile = filepath.Join(dir, "server.pem")
+	ServerKeyFile = filepath.Join(dir, "server-key.pem")
+	ClientCertFile = filepath.Join(dir, "client.pem")
+	ClientKeyFile = filepath.Join(dir, "client-key.pem")
+	RootClientCertFile = filepath.Join(dir, "root-client.pem")
+	RootClientKeyFile = filepath.Join(dir, "root-client-key.pem")
+	NobodyClientCertFile = filepath.Join(dir, "nobody-client.pem")
+	NobodyClientKeyFile = filepath.Join(dir, "nobody-client-key.pem")
+	ACLPolicyFile = filepath.Join(dir, "policy.csv")
+}
+
+func configDir() string {
 	if dir := os.Getenv("CONFIG_DIR"); dir != "" {
-		return filepath.Join(dir, filename)
+		return dir
 	}
 
 	homeDir, err := os.UserHomeDir()
@@ -25,5 +49,5 @@ func configFile(filename string) string {
 		panic(err)
 	}
 
-	return filepath.Join(homeDir, ".proglog", filename)
+	return filepath.Join(homeDir, ".proglog")
 }
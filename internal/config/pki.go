@@ -0,0 +1,196 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// certValidity is how long the certificates the CA issues are valid for.
+const certValidity = 365 * 24 * time.Hour
+
+// CA is a certificate authority that issues certificates in-process, so tests
+// and local clusters don't need cfssl.
+type CA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// NewCA creates a self-signed certificate authority named cn.
+func NewCA(cn string) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := newTemplate(cn)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{cert: cert, key: key}, nil
+}
+
+// WriteCert writes the CA's certificate to certFile, for use as
+// TLSConfig.CAFile.
+func (ca *CA) WriteCert(certFile string) error {
+	return writePEM(certFile, "CERTIFICATE", ca.cert.Raw)
+}
+
+// IssueServer writes a certificate and key for a server reachable at hosts,
+// which may be DNS names or IP addresses.
+func (ca *CA) IssueServer(certFile, keyFile string, hosts ...string) error {
+	cn := ""
+	if len(hosts) > 0 {
+		cn = hosts[0]
+	}
+
+	tmpl, err := newTemplate(cn)
+	if err != nil {
+		return err
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	return ca.issue(tmpl, certFile, keyFile)
+}
+
+// IssueClient writes a certificate and key identifying a client as cn, the
+// subject the server authorizes.
+func (ca *CA) IssueClient(certFile, keyFile, cn string) error {
+	tmpl, err := newTemplate(cn)
+	if err != nil {
+		return err
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	return ca.issue(tmpl, certFile, keyFile)
+}
+
+func (ca *CA) issue(tmpl *x509.Certificate, certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err = writePEM(certFile, "CERTIFICATE", der); err != nil {
+		return err
+	}
+
+	return writePEM(keyFile, "EC PRIVATE KEY", keyDER)
+}
+
+func newTemplate(cn string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   cn,
+			Organization: []string{"My Awesome Company"},
+		},
+		NotBefore: now.Add(-time.Minute),
+		NotAfter:  now.Add(certValidity),
+	}, nil
+}
+
+func writePEM(file, typ string, der []byte) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err = pem.Encode(f, &pem.Block{Type: typ, Bytes: der}); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// GenerateCerts writes a new CA, a server certificate for localhost and the
+// client, root and nobody client certificates into dir, using the file names
+// SetDir expects.
+func GenerateCerts(dir string) error {
+	ca, err := NewCA("My Awesome CA")
+	if err != nil {
+		return err
+	}
+
+	if err = ca.WriteCert(filepath.Join(dir, "ca.pem")); err != nil {
+		return err
+	}
+
+	err = ca.IssueServer(
+		filepath.Join(dir, "server.pem"),
+		filepath.Join(dir, "server-key.pem"),
+		"127.0.0.1",
+		"localhost",
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, client := range []struct {
+		name string
+		cn   string
+	}{
+		{name: "client", cn: "client"},
+		{name: "root-client", cn: "root"},
+		{name: "nobody-client", cn: "nobody"},
+	} {
+		err = ca.IssueClient(
+			filepath.Join(dir, client.name+".pem"),
+			filepath.Join(dir, client.name+"-key.pem"),
+			client.cn,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestGenerateCerts tests that the generated certificates let a client and a
+// server complete a mutual TLS handshake and identify each other.
+func TestGenerateCerts(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pki-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, GenerateCerts(dir))
+
+	serverTLSConfig, err := SetupTLSConfig(TLSConfig{
+		CertFile: filepath.Join(dir, "server.pem"),
+		KeyFile:  filepath.Join(dir, "server-key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		Server:   true,
+	})
+	require.NoError(t, err)
+
+	clientTLSConfig, err := SetupTLSConfig(TLSConfig{
+		CertFile:      filepath.Join(dir, "root-client.pem"),
+		KeyFile:       filepath.Join(dir, "root-client-key.pem"),
+		CAFile:        filepath.Join(dir, "ca.pem"),
+		ServerAddress: "127.0.0.1",
+	})
+	require.NoError(t, err)
+
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	server := tls.Server(s, serverTLSConfig)
+	client := tls.Client(c, clientTLSConfig)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Handshake()
+	}()
+	require.NoError(t, client.Handshake())
+	require.NoError(t, <-errc)
+
+	state := server.ConnectionState()
+	require.Equal(t, "root", state.PeerCertificates[0].Subject.CommonName)
+}
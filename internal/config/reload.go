@@ -0,0 +1,192 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSReloader keeps a TLS config in sync with the files in a TLSConfig. It
+// checks the files every interval and, when any has changed, rebuilds the
+// config with SetupTLSConfig. New handshakes pick up the new certificates
+// while existing connections carry on with the ones they were made with.
+type TLSReloader struct {
+	cfg      TLSConfig
+	interval time.Duration
+
+	mu       sync.RWMutex
+	current  *tls.Config
+	modTimes []time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTLSReloader loads the files in cfg and starts watching them.
+func NewTLSReloader(cfg TLSConfig, interval time.Duration) (*TLSReloader, error) {
+	r := &TLSReloader{
+		cfg:      cfg,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	go r.watch()
+
+	return r, nil
+}
+
+// Config returns a *tls.Config that always uses the latest certificates.
+// Servers get theirs through GetConfigForClient. Clients send theirs through
+// GetClientCertificate and verify the server against the latest CA in
+// VerifyConnection, because RootCAs can't be swapped once the config is in
+// use. Clients verify the server's certificate against ServerAddress, and
+// refuse every server if it's unset.
+func (r *TLSReloader) Config() *tls.Config {
+	if r.cfg.Server {
+		return &tls.Config{
+			GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				return r.load(), nil
+			},
+		}
+	}
+
+	return &tls.Config{
+		ServerName: r.cfg.ServerAddress,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c := r.load()
+			if len(c.Certificates) == 0 {
+				return &tls.Certificate{}, nil
+			}
+			return &c.Certificates[0], nil
+		},
+		// We verify the server ourselves in VerifyConnection.
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyServer,
+	}
+}
+
+// verifyServer checks the server's certificate chain and that it names
+// ServerAddress. The connection's ServerName can't be used: it's the SNI
+// value, which is empty for IP addresses, and an empty name skips the check.
+func (r *TLSReloader) verifyServer(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	if r.cfg.ServerAddress == "" {
+		return errors.New("no server address to verify the server's certificate against")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         r.load().RootCAs,
+		DNSName:       r.cfg.ServerAddress,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+func (r *TLSReloader) load() *tls.Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.current
+}
+
+// Reload rebuilds the TLS config from the files now. The previous config is
+// kept if the files can't be loaded, such as when only some of them have
+// been replaced so far.
+func (r *TLSReloader) Reload() error {
+	modTimes := r.stat()
+
+	c, err := SetupTLSConfig(r.cfg)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.current = c
+	r.modTimes = modTimes
+
+	return nil
+}
+
+func (r *TLSReloader) watch() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+
+			if err := r.Reload(); err != nil {
+				slog.Error("failed to reload TLS files", "error", err)
+				continue
+			}
+
+			slog.Info("reloaded TLS files", "cert", r.cfg.CertFile)
+		}
+	}
+}
+
+func (r *TLSReloader) files() []string {
+	return []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile}
+}
+
+// stat returns the modification time of each file, zero for files that are
+// unset or missing.
+func (r *TLSReloader) stat() []time.Time {
+	files := r.files()
+	modTimes := make([]time.Time, len(files))
+	for i, f := range files {
+		if f == "" {
+			continue
+		}
+
+		if fi, err := os.Stat(f); err == nil {
+			modTimes[i] = fi.ModTime()
+		}
+	}
+
+	return modTimes
+}
+
+func (r *TLSReloader) changed() bool {
+	modTimes := r.stat()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range modTimes {
+		if !modTimes[i].Equal(r.modTimes[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close stops watching the files. Configs already handed out keep using the
+// last certificates loaded.
+func (r *TLSReloader) Close() error {
+	r.closeOnce.Do(func() { close(r.done) })
+	return nil
+}
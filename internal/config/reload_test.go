@@ -0,0 +1,130 @@
+package config
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestTLSReloader tests that a server picks up rotated certificates without
+// dropping connections made with the old ones.
+func TestTLSReloader(t *testing.T) {
+	dir, err := os.MkdirTemp("", "reload-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, GenerateCerts(dir))
+
+	serverFiles := TLSConfig{
+		CertFile: filepath.Join(dir, "server.pem"),
+		KeyFile:  filepath.Join(dir, "server-key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		Server:   true,
+	}
+	clientFiles := TLSConfig{
+		CertFile:      filepath.Join(dir, "client.pem"),
+		KeyFile:       filepath.Join(dir, "client-key.pem"),
+		CAFile:        filepath.Join(dir, "ca.pem"),
+		ServerAddress: "127.0.0.1",
+	}
+
+	server, err := NewTLSReloader(serverFiles, 10*time.Millisecond)
+	require.NoError(t, err)
+	defer server.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", server.Config())
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	oldClientTLSConfig, err := SetupTLSConfig(clientFiles)
+	require.NoError(t, err)
+
+	oldConn := dialEcho(t, ln.Addr(), oldClientTLSConfig)
+	defer oldConn.Close()
+
+	// Rotating every certificate, CA included, makes the server reject
+	// clients with the old ones.
+	require.NoError(t, GenerateCerts(dir))
+	require.Eventually(t, func() bool {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), oldClientTLSConfig)
+		if err != nil {
+			return true
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("ping"))
+		if err != nil {
+			return true
+		}
+		_, err = conn.Read(make([]byte, 4))
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// A client reloading the same files trusts the new server.
+	client, err := NewTLSReloader(clientFiles, 10*time.Millisecond)
+	require.NoError(t, err)
+	defer client.Close()
+
+	newConn := dialEcho(t, ln.Addr(), client.Config())
+	defer newConn.Close()
+
+	// The connection made before the rotation still works.
+	echo(t, oldConn)
+
+	// A client expecting another address refuses the server, as does one
+	// that doesn't know what address to expect.
+	for _, addr := range []string{"10.9.9.9", ""} {
+		files := clientFiles
+		files.ServerAddress = addr
+		other, err := NewTLSReloader(files, time.Minute)
+		require.NoError(t, err)
+		defer other.Close()
+
+		conn, err := tls.Dial("tcp", ln.Addr().String(), other.Config())
+		if err == nil {
+			conn.Close()
+		}
+		require.Error(t, err, addr)
+	}
+}
+
+func dialEcho(t *testing.T, addr net.Addr, c *tls.Config) net.Conn {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr.String(), c)
+	require.NoError(t, err)
+	echo(t, conn)
+
+	return conn
+}
+
+func echo(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	want := []byte("hello tls")
+	_, err := conn.Write(want)
+	require.NoError(t, err)
+
+	got := make([]byte, len(want))
+	_, err = io.ReadFull(conn, got)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
@@ -15,6 +15,10 @@ type TLSConfig struct {
 	CAFile        string
 	ServerAddress string
 	Server        bool
+	// ClientCertOptional lets clients connect to a server without a
+	// certificate, for clients that authenticate with tokens instead.
+	// Certificates clients do present are still verified.
+	ClientCertOptional bool
 }
 
 func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
@@ -48,6 +52,9 @@ func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
 		if cfg.Server {
 			tlsConfig.ClientCAs = ca
 			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			if cfg.ClientCertOptional {
+				tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+			}
 		} else {
 			tlsConfig.RootCAs = ca
 		}
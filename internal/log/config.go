@@ -1,9 +1,41 @@
 package log
 
+import (
+	"time"
+
+	"github.com/petrostrak/proglog/internal/metrics"
+)
+
 type Config struct {
+	// Metrics, if set, is where the log reports its size, segment rolls,
+	// deletions and latencies.
+	Metrics *metrics.Registry
 	Segment struct {
 		MaxStoreBytes uint64
 		MaxIndexBytes uint64
 		InitialOffset uint64
 	}
+	// Retention is how much of the log EnforceRetention keeps. Zero values
+	// keep everything.
+	Retention struct {
+		// MaxBytes is how big the log's stores may get before the oldest
+		// segments are removed.
+		MaxBytes uint64
+		// MaxAge is how long after its last write a segment is kept.
+		MaxAge time.Duration
+	}
+	Replication struct {
+		// Enabled holds appended records back from Read until the
+		// high-water mark moves past them. NewLeader and NewFollower set it.
+		Enabled bool
+		// MaxLag is how long a follower may go without catching up to the
+		// leader before it drops out of the in-sync replica set.
+		MaxLag time.Duration
+		// MinInSyncReplicas is how many in-sync replicas, counting the
+		// leader, an ACKS_ALL produce needs.
+		MinInSyncReplicas int
+		// FetchWait is how long a follower's fetch waits for new records
+		// before the leader ends it.
+		FetchWait time.Duration
+	}
 }
@@ -0,0 +1,233 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Follower is a log that replicates from a leader by fetching over the
+// leader's ConsumeStream. Records show up in Read once the leader reports
+// them as committed.
+type Follower struct {
+	*Log
+
+	id     string
+	leader api.LogClient
+	admin  api.AdminClient
+
+	mu          sync.RWMutex
+	lastContact time.Time
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewFollower opens the log in dir and starts replicating into it from the
+// leader at the other end of cc, identifying itself as id.
+func NewFollower(dir string, c Config, id string, cc grpc.ClientConnInterface) (*Follower, error) {
+	c.Replication.Enabled = true
+
+	log, err := NewLog(dir, c)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Follower{
+		Log:    log,
+		id:     id,
+		leader: api.NewLogClient(cc),
+		admin:  api.NewAdminClient(cc),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go f.replicate()
+
+	return f, nil
+}
+
+// Append rejects writes, which have to go to the leader.
+func (f *Follower) Append(*api.Record) (uint64, error) {
+	return 0, api.ErrNotLeader{}
+}
+
+// replicate fetches from the leader until the follower is closed. If the
+// leader no longer has the records the follower needs next, the follower
+// restores a snapshot of the leader's log and carries on from there.
+func (f *Follower) replicate() {
+	defer close(f.done)
+
+	for {
+		err := f.fetch()
+		if f.ctx.Err() != nil {
+			return
+		}
+
+		if api.IsOffsetOutOfRange(err) {
+			err = f.bootstrap()
+		}
+
+		if err != nil {
+			slog.Error("failed to fetch from leader", "replica", f.id, "error", err)
+
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// fetch runs one fetch from the leader, appending the records it sends.
+func (f *Follower) fetch() error {
+	off := f.nextOffset()
+	stream, err := f.leader.ConsumeStream(f.ctx, &api.ConsumeRequest{
+		Offset:    off,
+		ReplicaId: f.id,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		f.mu.Lock()
+		f.lastContact = time.Now()
+		f.mu.Unlock()
+
+		if resp.Record != nil {
+			if resp.Record.Offset != off {
+				return fmt.Errorf(
+					"leader sent offset %d, want %d",
+					resp.Record.Offset,
+					off,
+				)
+			}
+
+			if _, err = f.Log.Append(resp.Record); err != nil {
+				return err
+			}
+			off++
+		}
+
+		f.SetHighWatermark(resp.HighWatermark)
+	}
+}
+
+// bootstrap replaces the follower's log with a snapshot of the leader's.
+func (f *Follower) bootstrap() error {
+	slog.Info("bootstrapping from leader snapshot", "replica", f.id)
+
+	ctx, cancel := context.WithCancel(f.ctx)
+	defer cancel()
+
+	stream, err := f.admin.Snapshot(ctx, &api.SnapshotRequest{})
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for {
+			chunk, err := stream.Recv()
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				pw.CloseWithError(err)
+				return
+			}
+
+			if _, err = pw.Write(chunk.Data); err != nil {
+				return
+			}
+		}
+	}()
+	defer pr.Close()
+
+	return f.Restore(pr)
+}
+
+// IsLeader, LastContact, ReadIndex and WaitApplied let the server serve
+// consistent reads from the follower.
+func (f *Follower) IsLeader() bool {
+	return false
+}
+
+func (f *Follower) LastContact() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.lastContact
+}
+
+// ReadIndex asks the leader for its high-water mark.
+func (f *Follower) ReadIndex(ctx context.Context) (uint64, error) {
+	res, err := f.leader.GetServers(ctx, &api.GetServersRequest{})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, srv := range res.Servers {
+		if srv.IsLeader && len(srv.Partitions) > 0 {
+			return srv.Partitions[0].HighWatermark, nil
+		}
+	}
+
+	return 0, fmt.Errorf("leader didn't report its high-water mark")
+}
+
+// WaitApplied blocks until the follower's high-water mark reaches off.
+func (f *Follower) WaitApplied(ctx context.Context, off uint64) error {
+	for {
+		changed := f.Changed()
+		if f.HighWatermark() >= off {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// Close stops replicating and closes the log.
+func (f *Follower) Close() error {
+	f.stop()
+	return f.Log.Close()
+}
+
+// Remove stops replicating and then removes the log's data.
+func (f *Follower) Remove() error {
+	f.stop()
+	return f.Log.Remove()
+}
+
+func (f *Follower) stop() {
+	f.closeOnce.Do(func() {
+		f.cancel()
+		<-f.done
+	})
+}
@@ -0,0 +1,292 @@
+package log
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// The functions in this file read a log's files without opening the log, so
+// they work on logs that won't open and never change what's on disk.
+
+// SegmentFiles are the files of a segment found in a log's directory. A
+// path is empty if its file is missing.
+type SegmentFiles struct {
+	BaseOffset uint64
+	StorePath  string
+	IndexPath  string
+}
+
+// ListSegments returns the segments in dir, ordered by base offset.
+func ListSegments(dir string) ([]SegmentFiles, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byBase := make(map[uint64]*SegmentFiles)
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".store" && ext != ".index") {
+			continue
+		}
+
+		base, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), ext), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		s, ok := byBase[base]
+		if !ok {
+			s = &SegmentFiles{BaseOffset: base}
+			byBase[base] = s
+		}
+
+		if ext == ".store" {
+			s.StorePath = filepath.Join(dir, e.Name())
+		} else {
+			s.IndexPath = filepath.Join(dir, e.Name())
+		}
+	}
+
+	segments := make([]SegmentFiles, 0, len(byBase))
+	for _, s := range byBase {
+		segments = append(segments, *s)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].BaseOffset < segments[j].BaseOffset
+	})
+
+	return segments, nil
+}
+
+// IndexEntry is an entry of a segment's index: the record at Offset,
+// relative to the segment's base offset, starts at Pos in the store.
+type IndexEntry struct {
+	Offset uint32
+	Pos    uint64
+}
+
+// ReadIndex returns every entry in the index file at path. Bytes after the
+// last whole entry are reported in the error along with the entries.
+func ReadIndex(path string) ([]IndexEntry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]IndexEntry, 0, uint64(len(b))/entWidth)
+	for pos := uint64(0); pos+entWidth <= uint64(len(b)); pos += entWidth {
+		entries = append(entries, IndexEntry{
+			Offset: enc.Uint32(b[pos : pos+offWidth]),
+			Pos:    enc.Uint64(b[pos+offWidth : pos+entWidth]),
+		})
+	}
+
+	if rem := uint64(len(b)) % entWidth; rem != 0 {
+		return entries, fmt.Errorf("%d trailing bytes after the last entry", rem)
+	}
+
+	return entries, nil
+}
+
+// ScanStore calls fn with the position and bytes of every record in the
+// store file at path, in order. A record cut short by the end of the file is
+// an io.ErrUnexpectedEOF.
+func ScanStore(path string, fn func(pos uint64, p []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := uint64(fi.Size())
+
+	r := bufio.NewReader(f)
+	lenBuf := make([]byte, lenWidth)
+	for pos := uint64(0); pos < size; {
+		if _, err = io.ReadFull(r, lenBuf); err != nil {
+			return fmt.Errorf("record length at position %d: %w", pos, io.ErrUnexpectedEOF)
+		}
+
+		n := enc.Uint64(lenBuf)
+		if n > size-pos-lenWidth {
+			return fmt.Errorf(
+				"record at position %d is %d bytes but the store ends after %d: %w",
+				pos,
+				n,
+				size-pos-lenWidth,
+				io.ErrUnexpectedEOF,
+			)
+		}
+
+		p := make([]byte, n)
+		if _, err = io.ReadFull(r, p); err != nil {
+			return err
+		}
+
+		if err = fn(pos, p); err != nil {
+			return err
+		}
+
+		pos += lenWidth + n
+	}
+
+	return nil
+}
+
+// SegmentReport is what VerifySegment found in a segment.
+type SegmentReport struct {
+	SegmentFiles
+	// Entries and Records are how many entries the index has and how many
+	// records the store has.
+	Entries int
+	Records int
+	// NextOffset is the offset the log would give the segment's next
+	// record, worked out from its last index entry as the log does.
+	NextOffset uint64
+	// Problems describes each inconsistency found.
+	Problems []string
+}
+
+// VerifySegment checks that every index entry points at the start of the
+// store's record with the same offset, that the records decode and that
+// the index has no entries past the store's records, such as the zeroed
+// entries an index that wasn't truncated on close ends with.
+func VerifySegment(s SegmentFiles) SegmentReport {
+	rep := SegmentReport{SegmentFiles: s, NextOffset: s.BaseOffset}
+	problem := func(format string, args ...any) {
+		rep.Problems = append(rep.Problems, fmt.Sprintf(format, args...))
+	}
+
+	if s.StorePath == "" {
+		problem("store file is missing")
+	}
+	if s.IndexPath == "" {
+		problem("index file is missing")
+	}
+	if s.StorePath == "" || s.IndexPath == "" {
+		return rep
+	}
+
+	entries, err := ReadIndex(s.IndexPath)
+	if err != nil {
+		problem("index: %v", err)
+	}
+	rep.Entries = len(entries)
+	if len(entries) > 0 {
+		rep.NextOffset = s.BaseOffset + uint64(entries[len(entries)-1].Offset) + 1
+	}
+
+	err = ScanStore(s.StorePath, func(pos uint64, p []byte) error {
+		i := rep.Records
+		rep.Records++
+		off := s.BaseOffset + uint64(i)
+
+		record := &api.Record{}
+		if err := proto.Unmarshal(p, record); err != nil {
+			problem("record %d at position %d doesn't decode: %v", off, pos, err)
+		} else if record.Offset != off {
+			problem("record at position %d has offset %d, want %d", pos, record.Offset, off)
+		}
+
+		if i >= len(entries) {
+			problem("record %d at position %d has no index entry", off, pos)
+			return nil
+		}
+
+		e := entries[i]
+		if e.Offset != uint32(i) {
+			problem("index entry %d has offset %d, want %d", i, e.Offset, i)
+		}
+		if e.Pos != pos {
+			problem("index entry %d points at position %d, but the record starts at %d", i, e.Pos, pos)
+		}
+
+		return nil
+	})
+	if err != nil {
+		problem("store: %v", err)
+	}
+
+	if extra := len(entries) - rep.Records; extra > 0 {
+		problem(
+			"index has %d entries past the store's %d records, as if it wasn't truncated when the log closed",
+			extra,
+			rep.Records,
+		)
+	}
+
+	return rep
+}
+
+// Report is what Verify found in a log's directory.
+type Report struct {
+	Segments []SegmentReport
+	// Problems describes inconsistencies between segments, such as gaps
+	// between one segment's next offset and the next one's base offset.
+	Problems []string
+}
+
+// OK reports whether no problems were found.
+func (r *Report) OK() bool {
+	if len(r.Problems) > 0 {
+		return false
+	}
+
+	for _, s := range r.Segments {
+		if len(s.Problems) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Verify checks every segment in dir with VerifySegment, and checks that
+// each segment's next offset is the next segment's base offset.
+func Verify(dir string) (*Report, error) {
+	segments, err := ListSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &Report{}
+	for i, s := range segments {
+		sr := VerifySegment(s)
+		rep.Segments = append(rep.Segments, sr)
+
+		if i == 0 {
+			continue
+		}
+
+		prev := rep.Segments[i-1]
+		if prev.NextOffset != s.BaseOffset {
+			rep.Problems = append(rep.Problems, fmt.Sprintf(
+				"segment %d ends at offset %d but the next segment starts at %d",
+				prev.BaseOffset,
+				prev.NextOffset,
+				s.BaseOffset,
+			))
+		}
+	}
+
+	if len(segments) == 0 {
+		return rep, errors.New("no segments found")
+	}
+
+	return rep, nil
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 64
+	c.Segment.InitialOffset = 5
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+
+	for i := 0; i < 8; i++ {
+		_, err = log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+
+	// While the log's open, its active index is grown to MaxIndexBytes.
+	rep, err := Verify(dir)
+	require.NoError(t, err)
+	require.False(t, rep.OK())
+
+	require.NoError(t, log.Close())
+
+	rep, err = Verify(dir)
+	require.NoError(t, err)
+	require.True(t, rep.OK(), "%+v", rep)
+	require.Greater(t, len(rep.Segments), 2)
+	require.Equal(t, uint64(5), rep.Segments[0].BaseOffset)
+
+	last := rep.Segments[len(rep.Segments)-1]
+	require.Equal(t, uint64(13), last.NextOffset)
+
+	var records int
+	for _, s := range rep.Segments {
+		require.Equal(t, s.Entries, s.Records)
+		records += s.Records
+	}
+	require.Equal(t, 8, records)
+
+	entries, err := ReadIndex(rep.Segments[0].IndexPath)
+	require.NoError(t, err)
+	require.Equal(t, IndexEntry{Offset: 0, Pos: 0}, entries[0])
+	require.Equal(t, uint32(1), entries[1].Offset)
+	require.Greater(t, entries[1].Pos, uint64(lenWidth))
+
+	// A store cut short leaves its index pointing past the end.
+	first := rep.Segments[0]
+	fi, err := os.Stat(first.StorePath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(first.StorePath, fi.Size()-1))
+
+	rep, err = Verify(dir)
+	require.NoError(t, err)
+	require.False(t, rep.OK())
+	require.NotEmpty(t, rep.Segments[0].Problems)
+
+	// Removing a segment leaves a gap in the offsets.
+	require.NoError(t, os.Remove(rep.Segments[1].StorePath))
+	require.NoError(t, os.Remove(rep.Segments[1].IndexPath))
+
+	rep, err = Verify(dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, rep.Problems)
+
+	_, err = Verify(t.TempDir())
+	require.Error(t, err)
+}
@@ -0,0 +1,334 @@
+// Leader and Follower replicate a log without consensus, the way Kafka's
+// in-sync replicas do: followers pull from a fixed leader, and the leader
+// only commits a record once every in-sync follower has fetched past it.
+
+package log
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// replicaState is what the leader knows about one follower.
+type replicaState struct {
+	// fetchOffset is the offset the follower last fetched from, so it has
+	// every record below it.
+	fetchOffset uint64
+	// lastFetch and lastFetchEnd are when the follower last fetched and
+	// where the leader's log ended at that time.
+	lastFetch    time.Time
+	lastFetchEnd uint64
+	// lastCaughtUp is the last time the follower had every record the
+	// leader had.
+	lastCaughtUp time.Time
+}
+
+// Leader is a log that followers replicate from. Its high-water mark is the
+// lowest offset fetched by its in-sync replicas.
+type Leader struct {
+	*Log
+
+	mu       sync.Mutex
+	replicas map[string]*replicaState
+	// lag, if the log has metrics, is how many records each follower is
+	// behind as of its last fetch.
+	lag *metrics.Gauge
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLeader opens the log in dir as the leader of its replicas.
+func NewLeader(dir string, c Config) (*Leader, error) {
+	c.Replication.Enabled = true
+	if c.Replication.MaxLag == 0 {
+		c.Replication.MaxLag = 10 * time.Second
+	}
+
+	if c.Replication.MinInSyncReplicas == 0 {
+		c.Replication.MinInSyncReplicas = 1
+	}
+
+	if c.Replication.FetchWait == 0 {
+		c.Replication.FetchWait = 500 * time.Millisecond
+	}
+
+	log, err := NewLog(dir, c)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Leader{
+		Log:      log,
+		replicas: make(map[string]*replicaState),
+		done:     make(chan struct{}),
+	}
+
+	if r := c.Metrics; r != nil {
+		l.lag = r.Gauge(
+			"proglog_replication_follower_lag_records",
+			"Records a follower was behind the leader at its last fetch.",
+			"replica",
+		)
+		r.GaugeFunc(
+			"proglog_replication_in_sync_replicas",
+			"Followers in the in-sync replica set, not counting the leader.",
+			func() float64 { return float64(len(l.InSyncReplicas())) },
+		)
+	}
+
+	go l.expire()
+
+	return l, nil
+}
+
+// expire periodically recomputes the high-water mark so it moves on once a
+// lagging follower drops out of the in-sync replicas.
+func (l *Leader) expire() {
+	ticker := time.NewTicker(l.Config.Replication.MaxLag / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			l.advance()
+			l.mu.Unlock()
+		}
+	}
+}
+
+// Append appends a record and returns once the leader has it.
+func (l *Leader) Append(record *api.Record) (uint64, error) {
+	return l.AppendAcks(context.Background(), record, api.Acks_ACKS_LEADER)
+}
+
+// AppendAcks appends a record and waits for the acknowledgements acks asks
+// for. With ACKS_ALL it blocks until the record is committed or ctx is done.
+func (l *Leader) AppendAcks(ctx context.Context, record *api.Record, acks api.Acks) (uint64, error) {
+	off, err := l.AppendUncommitted(record, acks)
+	if err != nil || acks != api.Acks_ACKS_ALL {
+		return off, err
+	}
+
+	if err = l.WaitCommitted(ctx, off); err != nil {
+		return 0, err
+	}
+
+	return off, nil
+}
+
+// AppendUncommitted appends a record like AppendAcks, but doesn't wait for
+// it to be committed, so callers can append more records while they wait
+// with WaitCommitted. ACKS_ALL appends still need enough in-sync replicas.
+func (l *Leader) AppendUncommitted(record *api.Record, acks api.Acks) (uint64, error) {
+	if acks == api.Acks_ACKS_ALL {
+		if n := len(l.InSyncReplicas()) + 1; n < l.Config.Replication.MinInSyncReplicas {
+			return 0, status.Errorf(
+				codes.Unavailable,
+				"%d in-sync replicas, need %d",
+				n,
+				l.Config.Replication.MinInSyncReplicas,
+			)
+		}
+	}
+
+	off, err := l.Log.Append(record)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	l.advance()
+	l.mu.Unlock()
+
+	return off, nil
+}
+
+// WaitCommitted blocks until the record at off is committed or ctx is done.
+func (l *Leader) WaitCommitted(ctx context.Context, off uint64) error {
+	for {
+		changed := l.Changed()
+		if l.HighWatermark() > off {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// Fetch serves a follower's fetch from off. Fetching from off acknowledges
+// every record below it. The leader sends records until the follower has
+// caught up and then returns so the follower's next fetch acknowledges them.
+// If there's nothing to send, it waits up to FetchWait for new records and
+// then sends the high-water mark on its own.
+func (l *Leader) Fetch(ctx context.Context, replicaID string, off uint64, send func(*api.ConsumeResponse) error) error {
+	lowest, err := l.LowestOffset()
+	if err != nil {
+		return err
+	}
+
+	if off < lowest {
+		return api.ErrOffsetOutOfRange{Offset: off}
+	}
+
+	l.fetched(replicaID, off)
+
+	timer := time.NewTimer(l.Config.Replication.FetchWait)
+	defer timer.Stop()
+
+	var sent, woke bool
+	for {
+		changed := l.Changed()
+		record, err := l.ReadUncommitted(off)
+		switch err.(type) {
+		case nil:
+			err = send(&api.ConsumeResponse{
+				Record:        record,
+				HighWatermark: l.HighWatermark(),
+			})
+			if err != nil {
+				return err
+			}
+			sent = true
+			off++
+			continue
+		case api.ErrOffsetOutOfRange:
+		default:
+			return err
+		}
+
+		if sent {
+			return nil
+		}
+
+		if woke {
+			return send(&api.ConsumeResponse{HighWatermark: l.HighWatermark()})
+		}
+
+		select {
+		case <-changed:
+			woke = true
+		case <-timer.C:
+			return send(&api.ConsumeResponse{HighWatermark: l.HighWatermark()})
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// fetched records that replicaID has every record below off.
+func (l *Leader) fetched(replicaID string, off uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	end := l.nextOffset()
+
+	r, ok := l.replicas[replicaID]
+	if !ok {
+		r = &replicaState{}
+		l.replicas[replicaID] = r
+	}
+
+	// A follower counts as caught up if it has everything the leader had
+	// at its previous fetch, so a steady stream of appends can't push it
+	// out of the in-sync replicas.
+	switch {
+	case off >= end:
+		r.lastCaughtUp = now
+	case ok && off >= r.lastFetchEnd:
+		r.lastCaughtUp = r.lastFetch
+	}
+
+	r.fetchOffset = off
+	r.lastFetch = now
+	r.lastFetchEnd = end
+
+	if l.lag != nil {
+		var lag uint64
+		if end > off {
+			lag = end - off
+		}
+		l.lag.Set(float64(lag), replicaID)
+	}
+
+	l.advance()
+}
+
+// advance moves the high-water mark to the lowest offset the in-sync
+// replicas have fetched. The caller must hold l.mu.
+func (l *Leader) advance() {
+	hwm := l.nextOffset()
+	for _, r := range l.replicas {
+		if l.inSync(r) && r.fetchOffset < hwm {
+			hwm = r.fetchOffset
+		}
+	}
+
+	l.SetHighWatermark(hwm)
+}
+
+func (l *Leader) inSync(r *replicaState) bool {
+	return time.Since(r.lastCaughtUp) <= l.Config.Replication.MaxLag
+}
+
+// InSyncReplicas returns the IDs of the followers that are in sync, not
+// counting the leader.
+func (l *Leader) InSyncReplicas() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ids []string
+	for id, r := range l.replicas {
+		if l.inSync(r) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// IsLeader, LastContact, ReadIndex and WaitApplied let the server serve
+// consistent reads. The leader is fixed, so it's always up to date.
+func (l *Leader) IsLeader() bool {
+	return true
+}
+
+func (l *Leader) LastContact() time.Time {
+	return time.Now()
+}
+
+func (l *Leader) ReadIndex(ctx context.Context) (uint64, error) {
+	return l.HighWatermark(), nil
+}
+
+func (l *Leader) WaitApplied(ctx context.Context, off uint64) error {
+	return nil
+}
+
+// Close stops tracking replicas and closes the log.
+func (l *Leader) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Log.Close()
+}
+
+// Remove closes the leader and then removes its data.
+func (l *Leader) Remove() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Log.Remove()
+}
@@ -0,0 +1,180 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestLeader tests that the leader only commits records once its in-sync
+// followers have fetched past them, and drops followers that fall behind.
+func TestLeader(t *testing.T) {
+	dir, err := os.MkdirTemp("", "leader-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Replication.MaxLag = 200 * time.Millisecond
+	c.Replication.FetchWait = 10 * time.Millisecond
+	l, err := NewLeader(dir, c)
+	require.NoError(t, err)
+	defer l.Close()
+
+	record := &api.Record{Value: []byte("hello world")}
+	ctx := context.Background()
+
+	// With no followers the leader commits on its own.
+	off, err := l.AppendAcks(ctx, record, api.Acks_ACKS_ALL)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), l.HighWatermark())
+
+	// A new follower receives the record along with the high-water mark,
+	// and joins the in-sync replicas once it has caught up.
+	var got []*api.ConsumeResponse
+	send := func(resp *api.ConsumeResponse) error {
+		got = append(got, resp)
+		return nil
+	}
+	require.NoError(t, l.Fetch(ctx, "follower", 0, send))
+	require.Len(t, got, 1)
+	require.Equal(t, off, got[0].Record.Offset)
+	require.Equal(t, uint64(1), got[0].HighWatermark)
+	require.Empty(t, l.InSyncReplicas())
+
+	// With nothing new to send, the fetch waits and then sends the
+	// high-water mark on its own.
+	got = nil
+	require.NoError(t, l.Fetch(ctx, "follower", 1, send))
+	require.Len(t, got, 1)
+	require.Nil(t, got[0].Record)
+	require.Equal(t, []string{"follower"}, l.InSyncReplicas())
+
+	// Leader acks don't wait for the follower, so the record isn't
+	// committed yet.
+	off, err = l.AppendAcks(ctx, record, api.Acks_ACKS_LEADER)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), l.HighWatermark())
+	_, err = l.Read(off)
+	require.Error(t, err)
+
+	// The follower's next fetch acknowledges the record.
+	got = nil
+	require.NoError(t, l.Fetch(ctx, "follower", 1, send))
+	require.NoError(t, l.Fetch(ctx, "follower", 2, send))
+	require.Equal(t, uint64(2), l.HighWatermark())
+	_, err = l.Read(off)
+	require.NoError(t, err)
+
+	// ACKS_ALL blocks until the follower fetches.
+	done := make(chan error)
+	go func() {
+		_, err := l.AppendAcks(ctx, record, api.Acks_ACKS_ALL)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("acks=all returned before the follower fetched")
+	case <-time.After(20 * time.Millisecond):
+	}
+	require.NoError(t, l.Fetch(ctx, "follower", 2, send))
+	require.NoError(t, l.Fetch(ctx, "follower", 3, send))
+	require.NoError(t, <-done)
+
+	// A follower that stops fetching drops out of the in-sync replicas and
+	// stops holding back the high-water mark.
+	_, err = l.AppendAcks(ctx, record, api.Acks_ACKS_LEADER)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return l.HighWatermark() == 4 && len(l.InSyncReplicas()) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// Too few in-sync replicas fails acks=all.
+	l.Config.Replication.MinInSyncReplicas = 2
+	_, err = l.AppendAcks(ctx, record, api.Acks_ACKS_ALL)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	// AppendUncommitted checks the in-sync replicas the same way, but
+	// leaves waiting for the commit to WaitCommitted.
+	_, err = l.AppendUncommitted(record, api.Acks_ACKS_ALL)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	l.Config.Replication.MinInSyncReplicas = 1
+	off, err = l.AppendUncommitted(record, api.Acks_ACKS_ALL)
+	require.NoError(t, err)
+	require.NoError(t, l.WaitCommitted(ctx, off))
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Equal(t, codes.Canceled, status.Code(l.WaitCommitted(cctx, off+1)))
+}
+
+// TestLeaderReset tests that resetting a leader doesn't reuse offsets its
+// followers already have, and that followers behind the reset have to
+// bootstrap again.
+func TestLeaderReset(t *testing.T) {
+	dir, err := os.MkdirTemp("", "leader-reset-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Replication.FetchWait = 10 * time.Millisecond
+	l, err := NewLeader(dir, c)
+	require.NoError(t, err)
+	defer l.Close()
+
+	record := &api.Record{Value: []byte("hello world")}
+	ctx := context.Background()
+	send := func(*api.ConsumeResponse) error { return nil }
+
+	for i := 0; i < 3; i++ {
+		_, err = l.Append(record)
+		require.NoError(t, err)
+	}
+
+	// One follower has caught up and another has fallen behind.
+	require.NoError(t, l.Fetch(ctx, "caught-up", 0, send))
+	require.NoError(t, l.Fetch(ctx, "caught-up", 3, send))
+	require.NoError(t, l.Fetch(ctx, "behind", 1, send))
+
+	require.NoError(t, l.Reset())
+	require.Equal(t, uint64(3), l.HighWatermark())
+
+	// The follower that was behind has to bootstrap instead of fetching
+	// offsets that now belong to different records.
+	err = l.Fetch(ctx, "behind", 1, send)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 1}, err)
+
+	// The follower that caught up carries on, and commits the next record.
+	done := make(chan error)
+	go func() {
+		off, err := l.AppendAcks(ctx, record, api.Acks_ACKS_ALL)
+		if err == nil && off != 3 {
+			err = fmt.Errorf("appended at %d, want 3", off)
+		}
+		done <- err
+	}()
+
+	var got []*api.ConsumeResponse
+	require.Eventually(t, func() bool {
+		got = nil
+		err := l.Fetch(ctx, "caught-up", 3, func(resp *api.ConsumeResponse) error {
+			got = append(got, resp)
+			return nil
+		})
+		return err == nil && len(got) == 1 && got[0].Record != nil
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(3), got[0].Record.Offset)
+
+	require.NoError(t, l.Fetch(ctx, "caught-up", 4, send))
+	require.NoError(t, <-done)
+
+	require.NoError(t, l.Close())
+	require.Equal(t, api.ErrLogClosed{}, l.Reset())
+}
@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	api "github.com/petrostrak/proglog/api/v1"
 )
@@ -21,6 +22,17 @@ type Log struct {
 
 	activeSegment *segment
 	segments      []*segment
+
+	// highWatermark is the offset below which records are visible to Read.
+	// Without replication it follows the end of the log.
+	highWatermark uint64
+	// changed is closed and replaced whenever a record is appended or the
+	// high-water mark moves.
+	changed chan struct{}
+	// closed is set once the log is closed.
+	closed bool
+
+	metrics *logMetrics
 }
 
 func NewLog(dir string, c Config) (*Log, error) {
@@ -33,8 +45,13 @@ func NewLog(dir string, c Config) (*Log, error) {
 	}
 
 	l := &Log{
-		Dir:    dir,
-		Config: c,
+		Dir:     dir,
+		Config:  c,
+		changed: make(chan struct{}),
+	}
+
+	if c.Metrics != nil {
+		l.instrument(c.Metrics)
 	}
 
 	return l, l.setup()
@@ -72,6 +89,11 @@ func (l *Log) setup() error {
 		}
 	}
 
+	// The high-water mark isn't persisted, so records already on disk are
+	// treated as committed when the log is opened.
+	l.highWatermark = l.activeSegment.nextOffset
+	l.closed = false
+
 	return nil
 }
 
@@ -92,9 +114,24 @@ func (l *Log) newSegment(off uint64) error {
 
 // Append appends a record to the log.
 func (l *Log) Append(record *api.Record) (uint64, error) {
+	defer l.metrics.observeAppend(time.Now())
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.closed {
+		return 0, api.ErrLogClosed{}
+	}
+
+	// A segment opened from disk may already be full, and appending to a
+	// full index would fail.
+	if l.activeSegment.IsMaxed() {
+		if err := l.newSegment(l.activeSegment.nextOffset); err != nil {
+			return 0, err
+		}
+		l.metrics.rolled()
+	}
+
 	// We append the record to the active segment.
 	off, err := l.activeSegment.Append(record)
 	if err != nil {
@@ -104,17 +141,53 @@ func (l *Log) Append(record *api.Record) (uint64, error) {
 	// If the segment is at its max size, we make a new
 	// active segment.
 	if l.activeSegment.IsMaxed() {
-		err = l.newSegment(off + 1)
+		if err = l.newSegment(off + 1); err == nil {
+			l.metrics.rolled()
+		}
 	}
 
+	// Without replication a record is committed as soon as it's written.
+	if !l.Config.Replication.Enabled {
+		l.highWatermark = off + 1
+	}
+	l.notify()
+
 	return off, err
 }
 
-// Read reads the record stored at the given offset.
+// Read reads the record stored at the given offset. Records at or above the
+// high-water mark aren't visible yet.
 func (l *Log) Read(off uint64) (*api.Record, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
+	if l.closed {
+		return nil, api.ErrLogClosed{}
+	}
+
+	if off >= l.highWatermark {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+
+	return l.read(off)
+}
+
+// ReadUncommitted reads the record stored at the given offset even if it's
+// above the high-water mark. The leader uses it to serve followers.
+func (l *Log) ReadUncommitted(off uint64) (*api.Record, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return nil, api.ErrLogClosed{}
+	}
+
+	return l.read(off)
+}
+
+func (l *Log) read(off uint64) (*api.Record, error) {
+	defer l.metrics.observeRead(time.Now())
+
 	var s *segment
 	for _, segment := range l.segments {
 		if segment.baseOffset <= off && off < segment.nextOffset {
@@ -127,14 +200,27 @@ func (l *Log) Read(off uint64) (*api.Record, error) {
 		return nil, api.ErrOffsetOutOfRange{Offset: off}
 	}
 
-	return s.Read(off)
+	// The offset is in the segment, so failing to read it means the files
+	// are damaged.
+	record, err := s.Read(off)
+	if err != nil {
+		return nil, api.ErrCorruptRecord{Offset: off, Err: err}
+	}
+
+	return record, nil
 }
 
-// Close iterates over the segments and closes them.
+// Close iterates over the segments and closes them. Closing a closed log
+// does nothing.
 func (l *Log) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+
 	for _, segment := range l.segments {
 		if err := segment.Close(); err != nil {
 			return err
@@ -144,6 +230,14 @@ func (l *Log) Close() error {
 	return nil
 }
 
+// Closed reports whether the log has been closed.
+func (l *Log) Closed() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.closed
+}
+
 // Remove closes the log and then removes its data.
 func (l *Log) Remove() error {
 	if err := l.Close(); err != nil {
@@ -153,13 +247,39 @@ func (l *Log) Remove() error {
 	return os.RemoveAll(l.Dir)
 }
 
-// Reset removes the log and then creates a new log to replace it.
+// Reset removes every record. Offsets carry on from where the log ended, so
+// an offset is never reused for a different record: readers and followers
+// that were further behind get ErrOffsetOutOfRange, and followers bootstrap
+// again.
 func (l *Log) Reset() error {
-	if err := l.Remove(); err != nil {
-		return err
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return api.ErrLogClosed{}
+	}
+
+	// The new active segment is created before the old ones are removed,
+	// so a failure leaves the log usable.
+	if next := l.activeSegment.nextOffset; next != l.activeSegment.baseOffset {
+		if err := l.newSegment(next); err != nil {
+			return err
+		}
+		l.metrics.rolled()
+	}
+
+	for len(l.segments) > 1 {
+		if err := l.segments[0].Remove(); err != nil {
+			return err
+		}
+		l.metrics.deletedSegment()
+		l.segments = l.segments[1:]
 	}
 
-	return l.setup()
+	l.highWatermark = l.activeSegment.nextOffset
+	l.notify()
+
+	return nil
 }
 
 func (l *Log) LowestOffset() (uint64, error) {
@@ -181,17 +301,74 @@ func (l *Log) HighestOffset() (uint64, error) {
 	return off - 1, nil
 }
 
+// HighWatermark returns the offset below which records are visible to Read.
+func (l *Log) HighWatermark() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.highWatermark
+}
+
+// SetHighWatermark advances the high-water mark to off, capped at the end of
+// the log. The high-water mark never moves backwards.
+func (l *Log) SetHighWatermark(off uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if next := l.activeSegment.nextOffset; off > next {
+		off = next
+	}
+
+	if off <= l.highWatermark {
+		return
+	}
+
+	l.highWatermark = off
+	l.notify()
+}
+
+// Changed returns a channel that's closed the next time a record is appended
+// or the high-water mark moves. Callers grab the channel before checking the
+// log so they can't miss a change in between.
+func (l *Log) Changed() <-chan struct{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.changed
+}
+
+// notify wakes everyone waiting on Changed. The caller must hold the write
+// lock.
+func (l *Log) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// nextOffset returns the offset the next appended record will get.
+func (l *Log) nextOffset() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.activeSegment.nextOffset
+}
+
 // Truncate removes all segments whose highest offset is lower than lowest.
+// The active segment is always kept.
 func (l *Log) Truncate(lowest uint64) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.closed {
+		return api.ErrLogClosed{}
+	}
+
 	var segments []*segment
 	for _, s := range l.segments {
-		if s.nextOffset <= lowest+1 {
+		if s != l.activeSegment && s.nextOffset <= lowest+1 {
 			if err := s.Remove(); err != nil {
 				return err
 			}
+			l.metrics.deletedSegment()
 			continue
 		}
 		segments = append(segments, s)
@@ -202,6 +379,52 @@ func (l *Log) Truncate(lowest uint64) error {
 	return nil
 }
 
+// Roll starts a new active segment, so the current one can be truncated or
+// retired by retention without waiting for it to fill up. It does nothing if
+// the active segment is empty.
+func (l *Log) Roll() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return api.ErrLogClosed{}
+	}
+
+	if l.activeSegment.nextOffset == l.activeSegment.baseOffset {
+		return nil
+	}
+
+	if err := l.newSegment(l.activeSegment.nextOffset); err != nil {
+		return err
+	}
+	l.metrics.rolled()
+
+	return nil
+}
+
+// Segments describes the log's segments, oldest first. The last one is the
+// active segment.
+func (l *Log) Segments() []*api.Segment {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	segments := make([]*api.Segment, len(l.segments))
+	for i, s := range l.segments {
+		s.store.mu.RLock()
+		storeBytes := s.store.size
+		s.store.mu.RUnlock()
+
+		segments[i] = &api.Segment{
+			BaseOffset: s.baseOffset,
+			NextOffset: s.nextOffset,
+			StoreBytes: storeBytes,
+			IndexBytes: s.index.size,
+		}
+	}
+
+	return segments
+}
+
 type originReader struct {
 	*store
 	off int64
@@ -1,12 +1,22 @@
 package log
 
 import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/metrics"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -19,13 +29,29 @@ func TestLog(t *testing.T) {
 		"init with existing segments":       testInitExisting,
 		"reader":                            testReader,
 		"truncate":                          testTruncate,
+		"high watermark":                    testHighWatermark,
+		"snapshot and restore":              testSnapshotRestore,
+		"snapshot while appending":          testSnapshotConcurrent,
+		"metrics":                           testMetrics,
+		"closed log":                        testClosed,
+		"corrupt record":                    testCorruptRecord,
+		"roll":                              testRoll,
+		"reset":                             testReset,
+		"retention":                         testRetention,
 	} {
 		t.Run(scenario, func(t *testing.T) {
-			dir := os.TempDir()
+			dir, err := os.MkdirTemp("", "log-test")
+			require.NoError(t, err)
 			defer os.RemoveAll(dir)
 
 			c := Config{}
 			c.Segment.MaxStoreBytes = 32
+			if scenario == "high watermark" {
+				c.Replication.Enabled = true
+			}
+			if scenario == "metrics" {
+				c.Metrics = metrics.NewRegistry()
+			}
 			log, err := NewLog(dir, c)
 			require.NoError(t, err)
 
@@ -115,3 +141,412 @@ func testTruncate(t *testing.T, log *Log) {
 	_, err = log.Read(0)
 	require.Error(t, err)
 }
+
+func testHighWatermark(t *testing.T, log *Log) {
+	append := &api.Record{
+		Value: []byte("hello world"),
+	}
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(append)
+		require.NoError(t, err)
+	}
+
+	// Replicated records stay hidden until they're committed.
+	require.Equal(t, uint64(0), log.HighWatermark())
+	_, err := log.Read(0)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 0}, err)
+
+	read, err := log.ReadUncommitted(0)
+	require.NoError(t, err)
+	require.Equal(t, append.Value, read.Value)
+
+	changed := log.Changed()
+	log.SetHighWatermark(2)
+	<-changed
+
+	_, err = log.Read(1)
+	require.NoError(t, err)
+	_, err = log.Read(2)
+	require.Error(t, err)
+
+	// The high-water mark is capped at the end of the log and never moves
+	// backwards.
+	log.SetHighWatermark(10)
+	require.Equal(t, uint64(3), log.HighWatermark())
+	log.SetHighWatermark(1)
+	require.Equal(t, uint64(3), log.HighWatermark())
+}
+
+func testSnapshotRestore(t *testing.T, log *Log) {
+	append := &api.Record{
+		Value: []byte("hello world"),
+	}
+	for i := 0; i < 5; i++ {
+		_, err := log.Append(append)
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Truncate(1))
+	require.Greater(t, len(log.segments), 1)
+
+	var buf bytes.Buffer
+	require.NoError(t, log.Snapshot(&buf))
+	snapshot := bytes.Clone(buf.Bytes())
+
+	dir, err := os.MkdirTemp("", "restore-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	restored, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+
+	// A truncated snapshot is rejected and leaves the log as it was.
+	err = restored.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()/2]))
+	require.Error(t, err)
+	off, err := restored.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+
+	require.NoError(t, restored.Restore(&buf))
+	require.Equal(t, len(log.segments), len(restored.segments))
+
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	off, err = restored.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, lowest, off)
+
+	for off := lowest; off < 5; off++ {
+		want, err := log.Read(off)
+		require.NoError(t, err)
+		got, err := restored.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, want.Value, got.Value)
+		require.Equal(t, want.Offset, got.Offset)
+	}
+
+	// Appends carry on from where the snapshot ended.
+	off, err = restored.Append(append)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), off)
+
+	// A snapshot that only turns out to be bad once its segments are open
+	// puts the log's own segments back.
+	bad := rewriteManifest(t, snapshot, func(m *manifest) {
+		m.Segments[0].NextOffset++
+	})
+	require.Error(t, restored.Restore(bytes.NewReader(bad)))
+	off, err = restored.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), off)
+	got, err := restored.Read(5)
+	require.NoError(t, err)
+	require.Equal(t, append.Value, got.Value)
+	off, err = restored.Append(append)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+
+	// If the log's own segments can't be put back either, the log is
+	// closed, keeping the files it moved aside.
+	var aside string
+	defer func() { rename = os.Rename }()
+	rename = func(from, to string) error {
+		// Moving the snapshot's files back out of the log's directory
+		// fails.
+		switch dir := filepath.Dir(to); {
+		case strings.HasPrefix(filepath.Base(dir), "restore-old"):
+			aside = dir
+		case dir != restored.Dir:
+			return errors.New("rename failed")
+		}
+		return os.Rename(from, to)
+	}
+	require.Error(t, restored.Restore(bytes.NewReader(bad)))
+	rename = os.Rename
+	defer os.RemoveAll(aside)
+	require.DirExists(t, aside)
+
+	require.True(t, restored.Closed())
+	_, err = restored.Append(append)
+	require.Equal(t, api.ErrLogClosed{}, err)
+	_, err = restored.Read(0)
+	require.Equal(t, api.ErrLogClosed{}, err)
+	off, err = restored.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+	require.NoError(t, restored.Close())
+	err = restored.Restore(bytes.NewReader(snapshot))
+	require.Equal(t, api.ErrLogClosed{}, err)
+}
+
+// rewriteManifest returns the snapshot with its manifest changed by fn.
+func rewriteManifest(t *testing.T, snapshot []byte, fn func(*manifest)) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tr := tar.NewReader(bytes.NewReader(snapshot))
+	tw := tar.NewWriter(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		b, err := io.ReadAll(tr)
+		require.NoError(t, err)
+
+		if hdr.Name == snapshotManifest {
+			m := &manifest{}
+			require.NoError(t, json.Unmarshal(b, m))
+			fn(m)
+			b, err = json.Marshal(m)
+			require.NoError(t, err)
+			hdr.Size = int64(len(b))
+		}
+
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err = tw.Write(b)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	return buf.Bytes()
+}
+
+func testSnapshotConcurrent(t *testing.T, log *Log) {
+	append := &api.Record{
+		Value: []byte("hello world"),
+	}
+	for i := 0; i < 5; i++ {
+		_, err := log.Append(append)
+		require.NoError(t, err)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		err := log.Snapshot(pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	// While the snapshot waits on its reader, the log can be appended to
+	// and have the segments being copied removed.
+	first := make([]byte, 1)
+	_, err := io.ReadFull(pr, first)
+	require.NoError(t, err)
+	_, err = log.Append(append)
+	require.NoError(t, err)
+	require.NoError(t, log.Truncate(3))
+	require.NoError(t, log.Close())
+
+	dir, err := os.MkdirTemp("", "restore-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	restored, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+
+	// The first byte of the snapshot was already read, so put it back.
+	r := io.MultiReader(bytes.NewReader(first), pr)
+	require.NoError(t, restored.Restore(r))
+	require.NoError(t, <-done)
+
+	// The snapshot has the log as it was when it started.
+	for off := uint64(0); off < 5; off++ {
+		got, err := restored.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, append.Value, got.Value)
+	}
+	_, err = restored.Read(5)
+	require.True(t, api.IsOffsetOutOfRange(err))
+}
+
+func testMetrics(t *testing.T, log *Log) {
+	append := &api.Record{
+		Value: []byte("hello world"),
+	}
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(append)
+		require.NoError(t, err)
+	}
+
+	_, err := log.Read(0)
+	require.NoError(t, err)
+
+	require.NoError(t, log.Truncate(1))
+
+	var buf bytes.Buffer
+	_, err = log.Config.Metrics.WriteTo(&buf)
+	require.NoError(t, err)
+
+	for _, want := range []string{
+		"proglog_log_append_duration_seconds_count 3\n",
+		"proglog_log_read_duration_seconds_count 1\n",
+		"proglog_log_segment_rolls_total 1\n",
+		"proglog_log_retention_deleted_segments_total 1\n",
+		"proglog_log_segments 1\n",
+		"proglog_log_store_bytes 23\n",
+		"proglog_log_index_bytes 12\n",
+		"proglog_log_active_index_fill_ratio 0.01171875\n",
+		"proglog_log_next_offset 3\n",
+		"proglog_log_high_watermark 3\n",
+	} {
+		require.Contains(t, buf.String(), want)
+	}
+
+	// A roll that fails isn't counted.
+	require.NoError(t, os.RemoveAll(log.Dir))
+	_, err = log.Append(append)
+	require.Error(t, err)
+
+	buf.Reset()
+	_, err = log.Config.Metrics.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "proglog_log_segment_rolls_total 1\n")
+}
+
+func testClosed(t *testing.T, log *Log) {
+	append := &api.Record{
+		Value: []byte("hello world"),
+	}
+	off, err := log.Append(append)
+	require.NoError(t, err)
+
+	require.NoError(t, log.Close())
+	require.True(t, log.Closed())
+
+	_, err = log.Append(append)
+	require.Equal(t, api.ErrLogClosed{}, err)
+
+	_, err = log.Read(off)
+	require.Equal(t, api.ErrLogClosed{}, err)
+
+	require.Equal(t, api.ErrLogClosed{}, log.Truncate(off))
+	require.Equal(t, api.ErrLogClosed{}, log.Roll())
+	_, err = log.EnforceRetention()
+	require.Equal(t, api.ErrLogClosed{}, err)
+}
+
+func testCorruptRecord(t *testing.T, log *Log) {
+	append := &api.Record{
+		Value: []byte("hello world"),
+	}
+	off, err := log.Append(append)
+	require.NoError(t, err)
+
+	// Reading flushes the record to the file, where we overwrite it with
+	// bytes that don't unmarshal.
+	_, err = log.Read(off)
+	require.NoError(t, err)
+	f, err := os.OpenFile(log.activeSegment.store.Name(), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff, 0xff}, lenWidth)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	_, err = log.Read(off)
+	var corrupt api.ErrCorruptRecord
+	require.ErrorAs(t, err, &corrupt)
+	require.Equal(t, off, corrupt.Offset)
+	require.Equal(t, codes.DataLoss, status.Code(err))
+}
+
+func testRoll(t *testing.T, log *Log) {
+	// An empty active segment isn't rolled.
+	require.NoError(t, log.Roll())
+	require.Len(t, log.Segments(), 1)
+
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+
+	require.NoError(t, log.Roll())
+	segments := log.Segments()
+	require.Len(t, segments, 2)
+	require.Equal(t, off+1, segments[1].BaseOffset)
+	require.Equal(t, off+1, segments[0].NextOffset)
+
+	read, err := log.Read(off)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), read.Value)
+}
+
+func testReset(t *testing.T, log *Log) {
+	append := &api.Record{
+		Value: []byte("hello world"),
+	}
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(append)
+		require.NoError(t, err)
+	}
+
+	changed := log.Changed()
+	require.NoError(t, log.Reset())
+	<-changed
+
+	// Offsets carry on from where the log ended.
+	require.Len(t, log.Segments(), 1)
+	require.Equal(t, uint64(3), log.HighWatermark())
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lowest)
+	_, err = log.Read(0)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 0}, err)
+
+	off, err := log.Append(append)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+
+	// An empty log is reset in place.
+	require.NoError(t, log.Reset())
+	require.NoError(t, log.Reset())
+	require.Len(t, log.Segments(), 1)
+	require.Equal(t, uint64(4), log.HighWatermark())
+
+	require.NoError(t, log.Close())
+	require.Equal(t, api.ErrLogClosed{}, log.Reset())
+}
+
+func testRetention(t *testing.T, log *Log) {
+	append := &api.Record{
+		Value: []byte("hello world"),
+	}
+	for i := 0; i < 6; i++ {
+		_, err := log.Append(append)
+		require.NoError(t, err)
+	}
+
+	// Without a policy nothing is removed.
+	removed, err := log.EnforceRetention()
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	// Each full segment holds two records, of about 45 bytes.
+	log.Config.Retention.MaxBytes = 60
+	removed, err = log.EnforceRetention()
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), lowest)
+
+	// Segments older than MaxAge are removed, but never the active one.
+	log.Config.Retention.MaxBytes = 0
+	log.Config.Retention.MaxAge = time.Hour
+	past := time.Now().Add(-2 * time.Hour)
+	for _, s := range log.segments {
+		require.NoError(t, os.Chtimes(s.store.Name(), past, past))
+	}
+
+	removed, err = log.EnforceRetention()
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	require.Len(t, log.Segments(), 1)
+
+	_, err = log.Read(5)
+	require.Error(t, err)
+	off, err := log.Append(append)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+}
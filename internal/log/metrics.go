@@ -0,0 +1,128 @@
+package log
+
+import (
+	"time"
+
+	"github.com/petrostrak/proglog/internal/metrics"
+)
+
+// logMetrics records what the log does in Config.Metrics. Its methods do
+// nothing on a nil *logMetrics, so a log without a registry pays nothing.
+type logMetrics struct {
+	appendSeconds *metrics.Histogram
+	readSeconds   *metrics.Histogram
+	rolls         *metrics.Counter
+	deleted       *metrics.Counter
+}
+
+// instrument registers the log's metrics in r. The gauges read the log when
+// they're scraped, so a registry should only hold one log.
+func (l *Log) instrument(r *metrics.Registry) {
+	l.metrics = &logMetrics{
+		appendSeconds: r.Histogram(
+			"proglog_log_append_duration_seconds",
+			"Time taken to append a record to the log.",
+			metrics.DefaultBuckets,
+		),
+		readSeconds: r.Histogram(
+			"proglog_log_read_duration_seconds",
+			"Time taken to read a record from the log.",
+			metrics.DefaultBuckets,
+		),
+		rolls: r.Counter(
+			"proglog_log_segment_rolls_total",
+			"Segments created because the active segment filled up.",
+		),
+		deleted: r.Counter(
+			"proglog_log_retention_deleted_segments_total",
+			"Segments deleted by truncating the log.",
+		),
+	}
+
+	r.GaugeFunc(
+		"proglog_log_segments",
+		"Segments in the log.",
+		func() float64 {
+			l.mu.RLock()
+			defer l.mu.RUnlock()
+			return float64(len(l.segments))
+		},
+	)
+	r.GaugeFunc(
+		"proglog_log_store_bytes",
+		"Bytes in the log's store files.",
+		func() float64 {
+			l.mu.RLock()
+			defer l.mu.RUnlock()
+
+			var size uint64
+			for _, s := range l.segments {
+				s.store.mu.RLock()
+				size += s.store.size
+				s.store.mu.RUnlock()
+			}
+			return float64(size)
+		},
+	)
+	r.GaugeFunc(
+		"proglog_log_index_bytes",
+		"Bytes of entries in the log's index files.",
+		func() float64 {
+			l.mu.RLock()
+			defer l.mu.RUnlock()
+
+			var size uint64
+			for _, s := range l.segments {
+				size += s.index.size
+			}
+			return float64(size)
+		},
+	)
+	r.GaugeFunc(
+		"proglog_log_active_index_fill_ratio",
+		"How full the active segment's index is, from 0 to 1.",
+		func() float64 {
+			l.mu.RLock()
+			defer l.mu.RUnlock()
+			return float64(l.activeSegment.index.size) / float64(l.Config.Segment.MaxIndexBytes)
+		},
+	)
+	r.GaugeFunc(
+		"proglog_log_next_offset",
+		"Offset the next appended record will get.",
+		func() float64 {
+			return float64(l.nextOffset())
+		},
+	)
+	r.GaugeFunc(
+		"proglog_log_high_watermark",
+		"Offset below which records are visible to consumers.",
+		func() float64 {
+			return float64(l.HighWatermark())
+		},
+	)
+}
+
+func (m *logMetrics) observeAppend(start time.Time) {
+	if m != nil {
+		m.appendSeconds.Observe(time.Since(start).Seconds())
+	}
+}
+
+func (m *logMetrics) observeRead(start time.Time) {
+	if m != nil {
+		m.readSeconds.Observe(time.Since(start).Seconds())
+	}
+}
+
+func (m *logMetrics) rolled() {
+	if m != nil {
+		m.rolls.Inc()
+	}
+}
+
+func (m *logMetrics) deletedSegment() {
+	if m != nil {
+		m.deleted.Inc()
+	}
+}
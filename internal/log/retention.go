@@ -0,0 +1,61 @@
+package log
+
+import (
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+)
+
+// EnforceRetention removes the oldest segments that Config.Retention no
+// longer keeps and returns how many it removed. Segments go in order, so the
+// log never has gaps, and the active segment and segments holding records
+// above the high-water mark are always kept.
+func (l *Log) EnforceRetention() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0, api.ErrLogClosed{}
+	}
+
+	r := l.Config.Retention
+	if r.MaxBytes == 0 && r.MaxAge == 0 {
+		return 0, nil
+	}
+
+	var size uint64
+	for _, s := range l.segments {
+		size += s.store.size
+	}
+
+	var removed int
+	for _, s := range l.segments {
+		if s == l.activeSegment || s.nextOffset > l.highWatermark {
+			break
+		}
+
+		fi, err := s.store.Stat()
+		if err != nil {
+			l.segments = l.segments[removed:]
+			return removed, err
+		}
+
+		tooBig := r.MaxBytes > 0 && size > r.MaxBytes
+		tooOld := r.MaxAge > 0 && time.Since(fi.ModTime()) > r.MaxAge
+		if !tooBig && !tooOld {
+			break
+		}
+
+		size -= s.store.size
+		if err = s.Remove(); err != nil {
+			l.segments = l.segments[removed:]
+			return removed, err
+		}
+		l.metrics.deletedSegment()
+		removed++
+	}
+
+	l.segments = l.segments[removed:]
+
+	return removed, nil
+}
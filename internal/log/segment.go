@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sync"
 
 	api "github.com/petrostrak/proglog/api/v1"
 	"google.golang.org/protobuf/proto"
@@ -15,6 +16,13 @@ type segment struct {
 	baseOffset uint64
 	nextOffset uint64
 	config     Config
+
+	// refs counts the snapshots copying the segment. Closing or removing
+	// the segment while they do leaves its files open until the last one
+	// is done, though a removed segment's files are unlinked straight away.
+	mu      sync.Mutex
+	refs    int
+	closing bool
 }
 
 // newSegment creates a new segment, such as when the current active segment
@@ -120,13 +128,28 @@ func (s *segment) Read(off uint64) (*api.Record, error) {
 }
 
 // IsMaxed returns whether the segment has reached its max size, either by
-// writting too much to the store of the index.
+// writting too much to the store or by having no room in the index for
+// another entry.
 func (s *segment) IsMaxed() bool {
 	return s.store.size >= s.config.Segment.MaxStoreBytes ||
-		s.index.size >= s.config.Segment.MaxIndexBytes
+		s.index.size+entWidth > s.config.Segment.MaxIndexBytes
 }
 
+// Close closes the segment's files, or leaves that to release if the segment
+// is in use.
 func (s *segment) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refs > 0 {
+		s.closing = true
+		return nil
+	}
+
+	return s.close()
+}
+
+func (s *segment) close() error {
 	if err := s.index.Close(); err != nil {
 		return err
 	}
@@ -136,6 +159,29 @@ func (s *segment) Close() error {
 	return nil
 }
 
+// acquire keeps the segment's files open until release is called.
+func (s *segment) acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refs++
+}
+
+// release undoes acquire, closing the segment if it was closed in the
+// meantime.
+func (s *segment) release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refs--
+	if s.refs > 0 || !s.closing {
+		return nil
+	}
+
+	s.closing = false
+	return s.close()
+}
+
 // Remove closes the segment and removes the index and store files.
 func (s *segment) Remove() error {
 	if err := s.Close(); err != nil {
@@ -13,7 +13,8 @@ import (
 // same record, and eventually hit the configured max size for both the store
 // and index.
 func TestSegment(t *testing.T) {
-	dir := os.TempDir()
+	dir, err := os.MkdirTemp("", "segment-test")
+	require.NoError(t, err)
 	defer os.RemoveAll(dir)
 
 	want := &api.Record{Value: []byte("hello world")}
@@ -56,4 +57,18 @@ func TestSegment(t *testing.T) {
 	s, err = newSegment(dir, 16, c)
 	require.NoError(t, err)
 	require.False(t, s.IsMaxed())
+
+	// An index that isn't a whole number of entries is maxed once there's
+	// no room for another entry.
+	require.NoError(t, s.Remove())
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = entWidth*3 + 4
+	s, err = newSegment(dir, 16, c)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = s.Append(want)
+		require.NoError(t, err)
+	}
+	require.True(t, s.IsMaxed())
+	require.NoError(t, s.Remove())
 }
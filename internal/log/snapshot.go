@@ -0,0 +1,407 @@
+// Snapshot and Restore copy a whole log, segment by segment, so a node can be
+// backed up or a follower can bootstrap from its leader.
+
+package log
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+)
+
+const (
+	snapshotVersion  = 1
+	snapshotManifest = "manifest.json"
+)
+
+// manifest is the first entry of a snapshot. It describes the segments whose
+// store and index files follow it.
+type manifest struct {
+	Version       int               `json:"version"`
+	CreatedAt     time.Time         `json:"created_at"`
+	HighWatermark uint64            `json:"high_watermark"`
+	Segments      []segmentManifest `json:"segments"`
+}
+
+type segmentManifest struct {
+	BaseOffset uint64 `json:"base_offset"`
+	NextOffset uint64 `json:"next_offset"`
+	StoreBytes uint64 `json:"store_bytes"`
+	IndexBytes uint64 `json:"index_bytes"`
+}
+
+// Snapshot writes the log to w as a tar archive: a JSON manifest followed by
+// each segment's store and index files, oldest first. The snapshot is of the
+// log as it was when Snapshot was called. The log isn't locked while the
+// snapshot is written, so a slow writer doesn't hold up appends.
+func (l *Log) Snapshot(w io.Writer) (err error) {
+	m, segments, err := l.snapshotSegments()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, s := range segments {
+			if rerr := s.release(); err == nil {
+				err = rerr
+			}
+		}
+	}()
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err = writeTarFile(tw, snapshotManifest, int64(len(b)), m.CreatedAt); err != nil {
+		return err
+	}
+
+	if _, err = tw.Write(b); err != nil {
+		return err
+	}
+
+	for i, s := range segments {
+		sm := m.Segments[i]
+
+		// The store's ReadAt flushes its buffer, so we copy what has been
+		// appended even if it hasn't reached the file yet.
+		name := fmt.Sprintf("%d%s", sm.BaseOffset, ".store")
+		if err = writeTarFile(tw, name, int64(sm.StoreBytes), m.CreatedAt); err != nil {
+			return err
+		}
+
+		_, err = io.Copy(tw, io.NewSectionReader(s.store, 0, int64(sm.StoreBytes)))
+		if err != nil {
+			return err
+		}
+
+		// We only copy the index's entries, not the space it was grown to.
+		name = fmt.Sprintf("%d%s", sm.BaseOffset, ".index")
+		if err = writeTarFile(tw, name, int64(sm.IndexBytes), m.CreatedAt); err != nil {
+			return err
+		}
+
+		if _, err = tw.Write(s.index.mmap[:sm.IndexBytes]); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+// snapshotSegments describes the log's segments as they are now and acquires
+// them, so they can be copied up to those sizes without holding the log's
+// lock. The caller has to release them.
+func (l *Log) snapshotSegments() (*manifest, []*segment, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return nil, nil, api.ErrLogClosed{}
+	}
+
+	m := &manifest{
+		Version:       snapshotVersion,
+		CreatedAt:     time.Now().UTC(),
+		HighWatermark: l.highWatermark,
+	}
+	segments := make([]*segment, len(l.segments))
+	for i, s := range l.segments {
+		m.Segments = append(m.Segments, segmentManifest{
+			BaseOffset: s.baseOffset,
+			NextOffset: s.nextOffset,
+			StoreBytes: s.store.size,
+			IndexBytes: s.index.size,
+		})
+		s.acquire()
+		segments[i] = s
+	}
+
+	return m, segments, nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, size int64, modTime time.Time) error {
+	return tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	})
+}
+
+// Restore replaces the log's contents with the snapshot read from r. The
+// snapshot is unpacked and checked next to the log's directory first, and
+// the log's files are only moved aside until the snapshot's are open, so a
+// bad snapshot leaves the log as it was. If the log's files can't be put
+// back, the log is closed and the files are left where they were moved to.
+func (l *Log) Restore(r io.Reader) error {
+	parent := filepath.Dir(filepath.Clean(l.Dir))
+	tmp, err := os.MkdirTemp(parent, "restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	m, err := l.unpack(r, tmp)
+	if err != nil {
+		return err
+	}
+
+	aside, err := os.MkdirTemp(parent, "restore-old")
+	if err != nil {
+		return err
+	}
+	keepAside := false
+	defer func() {
+		if !keepAside {
+			os.RemoveAll(aside)
+		}
+	}()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return api.ErrLogClosed{}
+	}
+
+	hwm := l.highWatermark
+	segments, active := l.segments, l.activeSegment
+	var moved renames
+	if err = l.restore(m, tmp, aside, &moved); err != nil {
+		if rerr := l.rollback(moved, hwm); rerr != nil {
+			l.abandon(segments, active)
+			keepAside = true
+			return fmt.Errorf(
+				"%w, and rolling back failed, so the log is closed and its files may be in %s: %v",
+				err, aside, rerr,
+			)
+		}
+		return err
+	}
+
+	// setup treats everything on disk as committed. A replicated log keeps
+	// the snapshot's high-water mark instead so it doesn't expose records
+	// the source hadn't committed.
+	if l.Config.Replication.Enabled && m.HighWatermark < l.highWatermark {
+		l.highWatermark = m.HighWatermark
+	}
+	l.notify()
+
+	return nil
+}
+
+// restore moves the log's segment files to aside, moves the snapshot's from
+// dir into their place and opens them. It records each move in moved so the
+// caller can roll back. The caller must hold the write lock.
+func (l *Log) restore(m *manifest, dir, aside string, moved *renames) error {
+	segments := l.segments
+	l.segments = nil
+	l.activeSegment = nil
+
+	for _, s := range segments {
+		if err := s.Close(); err != nil {
+			return err
+		}
+
+		for _, name := range []string{s.store.Name(), s.index.Name()} {
+			err := moved.rename(name, filepath.Join(aside, filepath.Base(name)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, sm := range m.Segments {
+		for _, ext := range []string{".store", ".index"} {
+			name := fmt.Sprintf("%d%s", sm.BaseOffset, ext)
+			err := moved.rename(filepath.Join(dir, name), filepath.Join(l.Dir, name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := l.setup(); err != nil {
+		return err
+	}
+
+	for i, s := range l.segments {
+		if s.nextOffset != m.Segments[i].NextOffset {
+			return fmt.Errorf(
+				"restored segment %d ends at offset %d, snapshot says %d",
+				s.baseOffset,
+				s.nextOffset,
+				m.Segments[i].NextOffset,
+			)
+		}
+	}
+
+	return nil
+}
+
+// rollback closes whatever restore opened, moves the log's files back and
+// reopens them with the high-water mark they had. The caller must hold the
+// write lock.
+func (l *Log) rollback(moved renames, hwm uint64) error {
+	for _, s := range l.segments {
+		if err := s.Close(); err != nil {
+			return err
+		}
+	}
+	l.segments = nil
+	l.activeSegment = nil
+
+	if err := moved.undo(); err != nil {
+		return err
+	}
+
+	if err := l.setup(); err != nil {
+		return err
+	}
+
+	if hwm < l.highWatermark {
+		l.highWatermark = hwm
+	}
+
+	return nil
+}
+
+// abandon closes the log after a failed rollback, when it has neither the
+// snapshot's segments nor its own. It closes whatever segments are open and
+// puts back the log's old ones, already closed, so later calls see a closed
+// log rather than no segments. The caller must hold the write lock.
+func (l *Log) abandon(segments []*segment, active *segment) {
+	for _, s := range l.segments {
+		s.Close()
+	}
+
+	l.segments, l.activeSegment = segments, active
+	l.closed = true
+	l.notify()
+}
+
+// rename moves files for Restore. Tests replace it to make moves fail.
+var rename = os.Rename
+
+// renames records files moved by Restore so they can be moved back.
+type renames [][2]string
+
+func (r *renames) rename(from, to string) error {
+	if err := rename(from, to); err != nil {
+		return err
+	}
+
+	*r = append(*r, [2]string{from, to})
+
+	return nil
+}
+
+// undo moves the files back, newest move first.
+func (r renames) undo() error {
+	for i := len(r) - 1; i >= 0; i-- {
+		if err := rename(r[i][1], r[i][0]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unpack extracts the snapshot in r into dir and checks it against its
+// manifest.
+func (l *Log) unpack(r io.Reader, dir string) (*manifest, error) {
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot manifest: %w", err)
+	}
+
+	if hdr.Name != snapshotManifest {
+		return nil, fmt.Errorf("snapshot starts with %q, not a manifest", hdr.Name)
+	}
+
+	m := &manifest{}
+	if err = json.NewDecoder(tr).Decode(m); err != nil {
+		return nil, fmt.Errorf("decode snapshot manifest: %w", err)
+	}
+
+	if m.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", m.Version)
+	}
+
+	if len(m.Segments) == 0 {
+		return nil, fmt.Errorf("snapshot has no segments")
+	}
+
+	want := make(map[string]uint64)
+	for _, sm := range m.Segments {
+		if sm.IndexBytes > l.Config.Segment.MaxIndexBytes {
+			return nil, fmt.Errorf(
+				"segment %d index is %d bytes, more than the log's max of %d",
+				sm.BaseOffset,
+				sm.IndexBytes,
+				l.Config.Segment.MaxIndexBytes,
+			)
+		}
+		want[fmt.Sprintf("%d%s", sm.BaseOffset, ".store")] = sm.StoreBytes
+		want[fmt.Sprintf("%d%s", sm.BaseOffset, ".index")] = sm.IndexBytes
+	}
+
+	for {
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		size, ok := want[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("unexpected file in snapshot: %q", hdr.Name)
+		}
+
+		if uint64(hdr.Size) != size {
+			return nil, fmt.Errorf(
+				"snapshot file %q is %d bytes, manifest says %d",
+				hdr.Name,
+				hdr.Size,
+				size,
+			)
+		}
+
+		if err = unpackFile(tr, filepath.Join(dir, hdr.Name)); err != nil {
+			return nil, err
+		}
+		delete(want, hdr.Name)
+	}
+
+	for name := range want {
+		return nil, fmt.Errorf("snapshot is missing %q", name)
+	}
+
+	return m, nil
+}
+
+func unpackFile(r io.Reader, name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
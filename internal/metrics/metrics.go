@@ -0,0 +1,414 @@
+// Package metrics keeps counters, gauges and histograms in a registry that
+// writes them in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, used for latencies.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metrics by name. Registering a name again returns the
+// metric already registered, so several servers can share a registry.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+type metric interface {
+	write(w io.Writer) error
+}
+
+// desc describes a metric and holds its series, one per set of label values.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	// value is the counter's or gauge's value, or the histogram's sum.
+	value   float64
+	count   uint64
+	buckets []uint64
+}
+
+func newDesc(name, help, kind string, labels []string) *desc {
+	return &desc{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+}
+
+func (d *desc) with(values []string, nbuckets int) *series {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf(
+			"metrics: %s has %d labels, got %d values",
+			d.name,
+			len(d.labels),
+			len(values),
+		))
+	}
+
+	key := strings.Join(values, "\xff")
+	s, ok := d.series[key]
+	if !ok {
+		s = &series{
+			labels:  append([]string(nil), values...),
+			buckets: make([]uint64, nbuckets),
+		}
+		d.series[key] = s
+	}
+
+	return s
+}
+
+func (d *desc) sorted() []*series {
+	ss := make([]*series, 0, len(d.series))
+	for _, s := range d.series {
+		ss = append(ss, s)
+	}
+	sort.Slice(ss, func(i, j int) bool {
+		return strings.Join(ss[i].labels, "\xff") < strings.Join(ss[j].labels, "\xff")
+	})
+
+	return ss
+}
+
+func (d *desc) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.kind)
+	return err
+}
+
+// register returns the metric registered as name, creating it with create if
+// there isn't one.
+func register[M metric](r *Registry, name string, create func() M) M {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if m, ok := r.metrics[name]; ok {
+		existing, ok := m.(M)
+		if !ok {
+			panic(fmt.Sprintf("metrics: %s is already registered as another type", name))
+		}
+		return existing
+	}
+
+	m := create()
+	r.metrics[name] = m
+	return m
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	*desc
+}
+
+// Counter registers a counter partitioned by the given labels. A counter
+// without labels is written as 0 until it's first incremented, so rates and
+// alerts on it work from the start.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return register(r, name, func() *Counter {
+		d := newDesc(name, help, "counter", labels)
+		if len(labels) == 0 {
+			d.with(nil, 0)
+		}
+		return &Counter{d}
+	})
+}
+
+// Add adds v to the series with the given label values.
+func (c *Counter) Add(v float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.with(values, 0).value += v
+}
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value returns the series' current value.
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.with(values, 0).value
+}
+
+func (c *Counter) write(w io.Writer) error {
+	return writeValues(w, c.desc)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	*desc
+}
+
+// Gauge registers a gauge partitioned by the given labels.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return register(r, name, func() *Gauge {
+		return &Gauge{newDesc(name, help, "gauge", labels)}
+	})
+}
+
+// Set sets the series with the given label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.with(values, 0).value = v
+}
+
+// Add adds v, which may be negative, to the series with the given label
+// values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.with(values, 0).value += v
+}
+
+// Value returns the series' current value.
+func (g *Gauge) Value(values ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.with(values, 0).value
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	return writeValues(w, g.desc)
+}
+
+func writeValues(w io.Writer, d *desc) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.writeHeader(w); err != nil {
+		return err
+	}
+
+	for _, s := range d.sorted() {
+		_, err := fmt.Fprintf(
+			w,
+			"%s%s %s\n",
+			d.name,
+			formatLabels(d.labels, s.labels, "", ""),
+			formatFloat(s.value),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GaugeFunc is a gauge whose value is read from a function when the metrics
+// are written, for values the registry can just ask for.
+type GaugeFunc struct {
+	*desc
+	fn func() float64
+}
+
+// GaugeFunc registers a gauge whose value fn returns.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return register(r, name, func() *GaugeFunc {
+		return &GaugeFunc{desc: newDesc(name, help, "gauge", nil), fn: fn}
+	})
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+	return err
+}
+
+// Histogram counts observations into buckets.
+type Histogram struct {
+	*desc
+	buckets []float64
+}
+
+// Histogram registers a histogram with the given upper bounds, partitioned
+// by the given labels.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return register(r, name, func() *Histogram {
+		return &Histogram{
+			desc:    newDesc(name, help, "histogram", labels),
+			buckets: buckets,
+		}
+	})
+}
+
+// Observe records v in the series with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.with(values, len(h.buckets))
+	s.value += v
+	s.count++
+	for i, b := range h.buckets {
+		if v <= b {
+			s.buckets[i]++
+		}
+	}
+}
+
+// Count returns the number of observations in the series.
+func (h *Histogram) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.with(values, len(h.buckets)).count
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+
+	for _, s := range h.sorted() {
+		for i, b := range h.buckets {
+			_, err := fmt.Fprintf(
+				w,
+				"%s_bucket%s %d\n",
+				h.name,
+				formatLabels(h.labels, s.labels, "le", formatFloat(b)),
+				s.buckets[i],
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		labels := formatLabels(h.labels, s.labels, "", "")
+		_, err := fmt.Fprintf(
+			w,
+			"%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name,
+			formatLabels(h.labels, s.labels, "le", "+Inf"),
+			s.count,
+			h.name,
+			labels,
+			formatFloat(s.value),
+			h.name,
+			labels,
+			s.count,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteTo writes every metric in the Prometheus text format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	for _, m := range metrics {
+		if err := m.write(cw); err != nil {
+			return cw.n, err
+		}
+	}
+
+	return cw.n, nil
+}
+
+// Handler serves the metrics to Prometheus scrapes.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := r.WriteTo(w); err != nil {
+			slog.Error("failed to write metrics", "error", err)
+		}
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// formatLabels formats label pairs, with an extra pair if extraName is set.
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+labelEscaper.Replace(extraValue)+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// labelEscaper escapes label values as the text format requires. Only
+// backslashes, double quotes and newlines are escaped; other characters,
+// including non-ASCII ones, are written as they are.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	c := r.Counter("requests_total", "Requests handled.", "method", "code")
+	c.Inc("Produce", "OK")
+	c.Inc("Produce", "OK")
+	c.Inc("Consume", "NotFound")
+
+	// Registering the same name again returns the same counter.
+	require.Equal(t, c, r.Counter("requests_total", "Requests handled.", "method", "code"))
+	require.Equal(t, float64(2), c.Value("Produce", "OK"))
+
+	g := r.Gauge("segments", "Segments in the log.")
+	g.Set(3)
+	g.Add(-1)
+
+	r.GaugeFunc("store_bytes", "Bytes in the store.", func() float64 { return 1024 })
+
+	h := r.Histogram("latency_seconds", "Request latency.", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+	require.Equal(t, uint64(3), h.Count())
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Equal(t, `# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{method="Consume",code="NotFound"} 1
+requests_total{method="Produce",code="OK"} 2
+# HELP segments Segments in the log.
+# TYPE segments gauge
+segments 2
+# HELP store_bytes Bytes in the store.
+# TYPE store_bytes gauge
+store_bytes 1024
+`, buf.String())
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, buf.String(), rec.Body.String())
+}
+
+// TestLabelEscaping tests that label values are escaped as the text format
+// requires, rather than as Go strings.
+func TestLabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("requests_total", "Requests handled.", "subject").Inc("é \\ \"quoted\"\nnext\t")
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `requests_total{subject="é \\ \"quoted\"\nnext`+"\t"+`"} 1`)
+}
+
+// TestCounterStartsAtZero tests that counters without labels are written
+// before they're first incremented.
+func TestCounterStartsAtZero(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("rolls_total", "Segments rolled.")
+	r.Counter("requests_total", "Requests handled.", "method")
+
+	var buf bytes.Buffer
+	_, err := r.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "rolls_total 0\n")
+	require.NotContains(t, buf.String(), "requests_total{")
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"context"
+	"io"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// snapshotChunkSize is how many bytes of a snapshot go in each chunk.
+const snapshotChunkSize = 64 * 1024
+
+// snapshotter is implemented by commit logs that can be copied whole, such as
+// *log.Log.
+type snapshotter interface {
+	Snapshot(io.Writer) error
+}
+
+// segmentLister is implemented by commit logs made of segments, such as
+// *log.Log.
+type segmentLister interface {
+	Segments() []*api.Segment
+}
+
+// logManager is implemented by commit logs that operators can roll,
+// truncate, delete and apply retention to, such as *log.Log.
+type logManager interface {
+	Roll() error
+	Truncate(lowest uint64) error
+	Reset() error
+	EnforceRetention() (int, error)
+}
+
+var _ api.AdminServer = (*adminServer)(nil)
+
+// adminServer implements the operator facing Admin service on top of the
+// same Config as the log service.
+type adminServer struct {
+	api.UnimplementedAdminServer
+	*Config
+}
+
+func newadminServer(cfg *Config) (srv *adminServer, err error) {
+	if cfg.GetServerer == nil {
+		cfg.GetServerer = &localServer{Config: cfg}
+	}
+
+	srv = &adminServer{
+		Config: cfg,
+	}
+
+	return srv, nil
+}
+
+// DescribeCluster returns the same servers as GetServers, and also names the
+// leader and the node that answered so operators can tell where they landed.
+func (s *adminServer) DescribeCluster(ctx context.Context, req *api.DescribeClusterRequest) (*api.DescribeClusterResponse, error) {
+	if err := s.authorize(ctx, clusterObject, describeAction); err != nil {
+		return nil, err
+	}
+
+	servers, err := s.GetServerer.GetServers()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.DescribeClusterResponse{
+		Servers: servers,
+		LocalId: s.ServerID,
+	}
+	for _, srv := range servers {
+		if srv.IsLeader {
+			resp.LeaderId = srv.Id
+			break
+		}
+	}
+
+	return resp, nil
+}
+
+// Snapshot streams a snapshot of the log, for backups and for followers
+// bootstrapping from the leader.
+func (s *adminServer) Snapshot(req *api.SnapshotRequest, stream api.Admin_SnapshotServer) error {
+	if err := s.authorize(stream.Context(), DefaultTopic, snapshotAction); err != nil {
+		return err
+	}
+
+	sn, ok := s.CommitLog.(snapshotter)
+	if !ok {
+		return status.Error(codes.Unimplemented, "log doesn't support snapshots")
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(sn.Snapshot(pw))
+	}()
+	defer pr.Close()
+
+	for {
+		// Each chunk gets its own buffer since gRPC may hold on to a
+		// message after Send returns.
+		buf := make([]byte, snapshotChunkSize)
+		n, err := io.ReadFull(pr, buf)
+		if n > 0 {
+			if err := stream.Send(&api.SnapshotChunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// DescribeLog returns the range of offsets in the log and its segments.
+func (s *adminServer) DescribeLog(ctx context.Context, req *api.DescribeLogRequest) (*api.DescribeLogResponse, error) {
+	if err := s.authorize(ctx, DefaultTopic, describeAction); err != nil {
+		return nil, err
+	}
+
+	r, ok := s.CommitLog.(offsetRanger)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "log can't be described")
+	}
+
+	resp := &api.DescribeLogResponse{}
+	var err error
+	if resp.LowestOffset, err = r.LowestOffset(); err != nil {
+		return nil, err
+	}
+	if resp.HighestOffset, err = r.HighestOffset(); err != nil {
+		return nil, err
+	}
+
+	if h, ok := s.CommitLog.(highWatermarker); ok {
+		resp.HighWatermark = h.HighWatermark()
+	}
+	if l, ok := s.CommitLog.(segmentLister); ok {
+		resp.Segments = l.Segments()
+	}
+
+	return resp, nil
+}
+
+// RollSegment starts a new active segment.
+func (s *adminServer) RollSegment(ctx context.Context, req *api.RollSegmentRequest) (*api.RollSegmentResponse, error) {
+	m, err := s.logManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = m.Roll(); err != nil {
+		return nil, err
+	}
+
+	resp := &api.RollSegmentResponse{}
+	if l, ok := m.(segmentLister); ok {
+		segments := l.Segments()
+		resp.BaseOffset = segments[len(segments)-1].BaseOffset
+	}
+
+	return resp, nil
+}
+
+// TruncateLog removes the segments below the requested offset.
+func (s *adminServer) TruncateLog(ctx context.Context, req *api.TruncateLogRequest) (*api.TruncateLogResponse, error) {
+	m, err := s.logManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Records above the high-water mark haven't been committed, so they
+	// may not have reached the followers yet.
+	if h, ok := m.(highWatermarker); ok {
+		if hwm := h.HighWatermark(); req.BeforeOffset > hwm {
+			return nil, status.Errorf(
+				codes.FailedPrecondition,
+				"before_offset %d is above the high-water mark %d",
+				req.BeforeOffset,
+				hwm,
+			)
+		}
+	}
+
+	// Truncate keeps segments holding its argument, so it's given the
+	// highest offset to remove.
+	if req.BeforeOffset > 0 {
+		if err = m.Truncate(req.BeforeOffset - 1); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &api.TruncateLogResponse{}
+	if r, ok := m.(offsetRanger); ok {
+		if resp.LowestOffset, err = r.LowestOffset(); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// DeleteLog removes every record in the log.
+func (s *adminServer) DeleteLog(ctx context.Context, req *api.DeleteLogRequest) (*api.DeleteLogResponse, error) {
+	m, err := s.logManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = m.Reset(); err != nil {
+		return nil, err
+	}
+
+	return &api.DeleteLogResponse{}, nil
+}
+
+// EnforceRetention applies the log's retention policy now.
+func (s *adminServer) EnforceRetention(ctx context.Context, req *api.EnforceRetentionRequest) (*api.EnforceRetentionResponse, error) {
+	m, err := s.logManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := m.EnforceRetention()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.EnforceRetentionResponse{RemovedSegments: uint32(removed)}
+	if r, ok := m.(offsetRanger); ok {
+		if resp.LowestOffset, err = r.LowestOffset(); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+// logManager authorizes the caller to change the log and returns it.
+func (s *adminServer) logManager(ctx context.Context) (logManager, error) {
+	if err := s.authorize(ctx, DefaultTopic, manageAction); err != nil {
+		return nil, err
+	}
+
+	m, ok := s.CommitLog.(logManager)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "log can't be managed")
+	}
+
+	return m, nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The objects and actions the server authorizes. Actions on the log are on
+// its topic, and describing the servers is on clusterObject.
+const (
+	clusterObject = "cluster"
+
+	produceAction   = "produce"
+	consumeAction   = "consume"
+	describeAction  = "describe"
+	replicateAction = "replicate"
+	snapshotAction  = "snapshot"
+	// manageAction covers the admin RPCs that change the log, such as
+	// truncating or deleting it.
+	manageAction = "manage"
+)
+
+// Authorizer decides whether a subject may perform an action on an object,
+// returning a PermissionDenied status error if not.
+type Authorizer interface {
+	Authorize(subject, object, action string) error
+}
+
+// Authenticator verifies bearer tokens and API keys for clients that can't
+// present a client certificate.
+type Authenticator interface {
+	Authenticate(credential string) (auth.Principal, error)
+}
+
+// authorize checks that the caller in ctx may perform action on object.
+// Without an Authorizer every call is allowed.
+func (c *Config) authorize(ctx context.Context, object, action string) error {
+	if c.Authorizer == nil {
+		return nil
+	}
+
+	return c.Authorizer.Authorize(principal(ctx).Subject, object, action)
+}
+
+type principalContextKey struct{}
+
+// principal returns the caller that authenticate stored in ctx.
+func principal(ctx context.Context) auth.Principal {
+	p, _ := ctx.Value(principalContextKey{}).(auth.Principal)
+	return p
+}
+
+// authenticate works out who the caller is. A bearer credential wins if the
+// caller sent one and the server has an Authenticator; otherwise the caller
+// is the common name of its verified client certificate. Callers with
+// neither are refused if the server could have authenticated them, because
+// it accepts credentials or the connection uses TLS. Otherwise, on a server
+// with no authentication at all, they get an empty subject.
+func (c *Config) authenticate(ctx context.Context, credential string, state *tls.ConnectionState) (context.Context, error) {
+	var p auth.Principal
+	switch {
+	case credential != "" && c.Authenticator != nil:
+		var err error
+		p, err = c.Authenticator.Authenticate(credential)
+		if err != nil {
+			return ctx, api.ErrUnauthenticated{Reason: err.Error()}
+		}
+	case state != nil && len(state.VerifiedChains) > 0:
+		p = auth.Principal{
+			Subject: state.VerifiedChains[0][0].Subject.CommonName,
+			Method:  auth.MethodMTLS,
+		}
+	case c.Authenticator != nil || state != nil:
+		return ctx, api.ErrUnauthenticated{Reason: "no client certificate or bearer credential"}
+	}
+
+	setCallSubject(ctx, p.Subject)
+
+	return context.WithValue(ctx, principalContextKey{}, p), nil
+}
+
+// bearer returns the credential from an "Authorization: Bearer" value.
+func bearer(authorization string) string {
+	scheme, credential, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(credential)
+}
+
+func (c *Config) authenticateGRPC(ctx context.Context) (context.Context, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx, status.New(
+			codes.Unknown,
+			"couldn't find peer info",
+		).Err()
+	}
+
+	var state *tls.ConnectionState
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		state = &tlsInfo.State
+	}
+
+	var credential string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			credential = bearer(v[0])
+		}
+	}
+
+	return c.authenticate(ctx, credential, state)
+}
+
+func (c *Config) authenticateUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := c.authenticateGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+func (c *Config) authenticateStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := c.authenticateGRPC(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	return handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+}
+
+// contextStream overrides the stream's context with one carrying what the
+// interceptors have added, such as the principal.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticateHTTP is the HTTP counterpart of the gRPC interceptors.
+func (c *Config) authenticateHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := c.authenticate(
+			r.Context(),
+			bearer(r.Header.Get("Authorization")),
+			r.TLS,
+		)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
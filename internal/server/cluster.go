@@ -0,0 +1,63 @@
+package server
+
+import (
+	api "github.com/petrostrak/proglog/api/v1"
+)
+
+// offsetRanger is implemented by commit logs that can report the range of
+// offsets they hold, such as *log.Log.
+type offsetRanger interface {
+	LowestOffset() (uint64, error)
+	HighestOffset() (uint64, error)
+}
+
+// highWatermarker is implemented by commit logs that hold records back from
+// consumers until they're replicated, such as *log.Log.
+type highWatermarker interface {
+	HighWatermark() uint64
+}
+
+// localServer is the GetServerer used when the server isn't part of a
+// cluster. It reports this node as the only server, and as the leader of its
+// log unless the log is a follower.
+type localServer struct {
+	*Config
+}
+
+func (l *localServer) GetServers() ([]*api.Server, error) {
+	srv := &api.Server{
+		Id:       l.ServerID,
+		RpcAddr:  l.RPCAddr,
+		IsLeader: true,
+	}
+
+	if r, ok := l.CommitLog.(Replica); ok {
+		srv.IsLeader = r.IsLeader()
+	}
+
+	r, ok := l.CommitLog.(offsetRanger)
+	if !ok {
+		return []*api.Server{srv}, nil
+	}
+
+	lowest, err := r.LowestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	highest, err := r.HighestOffset()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &api.PartitionRange{
+		LowestOffset:  lowest,
+		HighestOffset: highest,
+	}
+	if h, ok := l.CommitLog.(highWatermarker); ok {
+		p.HighWatermark = h.HighWatermark()
+	}
+	srv.Partitions = []*api.PartitionRange{p}
+
+	return []*api.Server{srv}, nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Replica is implemented by replicated commit logs so the server can honour
+// the consistency level a consumer asks for. A commit log that doesn't
+// implement it is the only copy of its data, so every read from it is
+// already linearizable.
+type Replica interface {
+	// IsLeader reports whether this node is the leader of its log.
+	IsLeader() bool
+	// LastContact returns when this node last heard from its leader.
+	LastContact() time.Time
+	// ReadIndex returns the leader's commit offset: every record below it
+	// was acknowledged before the call.
+	ReadIndex(ctx context.Context) (uint64, error)
+	// WaitApplied blocks until every record below off is readable locally.
+	WaitApplied(ctx context.Context, off uint64) error
+}
+
+// checkConsistency blocks or fails the read described by req until the local
+// log is fresh enough to serve it.
+func (s *grpcServer) checkConsistency(ctx context.Context, req *api.ConsumeRequest) error {
+	r, ok := s.CommitLog.(Replica)
+	if !ok {
+		return nil
+	}
+
+	switch req.Consistency {
+	case api.Consistency_CONSISTENCY_ANY:
+		return nil
+	case api.Consistency_CONSISTENCY_BOUNDED_STALENESS:
+		if req.MaxStaleness == nil {
+			return status.Error(
+				codes.InvalidArgument,
+				"max_staleness is required for bounded staleness reads",
+			)
+		}
+
+		if r.IsLeader() {
+			return nil
+		}
+
+		bound := req.MaxStaleness.AsDuration()
+		if staleness := time.Since(r.LastContact()); staleness > bound {
+			return status.Errorf(
+				codes.Unavailable,
+				"replica last heard from its leader %s ago, more than the %s allowed",
+				staleness.Round(time.Millisecond),
+				bound,
+			)
+		}
+
+		return nil
+	case api.Consistency_CONSISTENCY_LINEARIZABLE:
+		idx, err := r.ReadIndex(ctx)
+		if err != nil {
+			return err
+		}
+
+		return r.WaitApplied(ctx, idx)
+	default:
+		return status.Errorf(
+			codes.InvalidArgument,
+			"unknown consistency level: %v",
+			req.Consistency,
+		)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errDraining is returned to produces and open streams once the server has
+// started shutting down, so clients retry against another server.
+var errDraining = status.Error(codes.Unavailable, "server is shutting down")
+
+// Drain starts shutting down the servers built from c. Produces are refused,
+// consume, event and health watch streams end so a graceful stop doesn't wait
+// on them, and health checks report NOT_SERVING. Reads are still served
+// until the servers stop. Calling Drain again has no effect.
+func (c *Config) Drain() {
+	c.drainMu.Lock()
+	defer c.drainMu.Unlock()
+
+	if c.drained == nil {
+		c.drained = make(chan struct{})
+	}
+
+	select {
+	case <-c.drained:
+	default:
+		close(c.drained)
+	}
+}
+
+// draining returns a channel that's closed once Drain is called.
+func (c *Config) draining() <-chan struct{} {
+	c.drainMu.Lock()
+	defer c.drainMu.Unlock()
+
+	if c.drained == nil {
+		c.drained = make(chan struct{})
+	}
+
+	return c.drained
+}
+
+func (c *Config) isDraining() bool {
+	select {
+	case <-c.draining():
+		return true
+	default:
+		return false
+	}
+}
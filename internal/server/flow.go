@@ -0,0 +1,302 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// produceWindow is how many of a ProduceStream's records may be waiting for
+// their acknowledgements at once.
+var produceWindow = 64
+
+// pipelinedAppender is implemented by replicated commit logs that can append
+// a record and wait for it to be committed separately, such as *log.Leader,
+// so a ProduceStream can have several ACKS_ALL records waiting at once.
+type pipelinedAppender interface {
+	AppendUncommitted(*api.Record, api.Acks) (uint64, error)
+	WaitCommitted(ctx context.Context, off uint64) error
+}
+
+// produced is a record a ProduceStream appended, waiting to be acknowledged.
+type produced struct {
+	off  uint64
+	acks api.Acks
+	// uncommitted is set if the record still has to be committed before
+	// it's acknowledged.
+	uncommitted bool
+	err         error
+}
+
+// receiveProduces appends each record received on stream and queues it on
+// window to be acknowledged, until the producer closes the stream or ctx is
+// done. It stops after queuing the first failed append.
+func (s *grpcServer) receiveProduces(ctx context.Context, stream api.Log_ProduceStreamServer, window chan<- produced) error {
+	requests := receive(ctx, stream)
+	for {
+		var r received
+		select {
+		case r = <-requests:
+		case <-ctx.Done():
+			return nil
+		}
+
+		// Both cases may have been ready, and nothing is appended once
+		// the stream has failed.
+		if ctx.Err() != nil {
+			return nil
+		}
+		if r.err == io.EOF {
+			return nil
+		}
+		if r.err != nil {
+			return r.err
+		}
+
+		p := produced{acks: r.req.Acks}
+		if p.err = s.authorize(ctx, DefaultTopic, produceAction); p.err == nil {
+			p.off, p.uncommitted, p.err = s.appendUncommitted(ctx, r.req.Record, r.req.Acks)
+		}
+
+		select {
+		case window <- p:
+		case <-ctx.Done():
+			return nil
+		}
+
+		if p.err != nil {
+			return nil
+		}
+	}
+}
+
+// received is a request read from a ProduceStream, or the error that ended
+// it.
+type received struct {
+	req *api.ProduceRequest
+	err error
+}
+
+// receive reads stream's requests on a goroutine of its own, so that
+// receiveProduces can stop when ctx is done instead of waiting in Recv for a
+// request that may never come. The goroutine ends after the first error, or
+// once ctx is done and it's next woken by the stream.
+func receive(ctx context.Context, stream api.Log_ProduceStreamServer) <-chan received {
+	requests := make(chan received)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			select {
+			case requests <- received{req, err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return requests
+}
+
+// appendUncommitted appends the record like append, except that an ACKS_ALL
+// record isn't waited for if the log can wait for it separately, in which
+// case uncommitted is set.
+func (c *Config) appendUncommitted(ctx context.Context, record *api.Record, acks api.Acks) (off uint64, uncommitted bool, err error) {
+	p, ok := c.CommitLog.(pipelinedAppender)
+	if !ok || acks != api.Acks_ACKS_ALL {
+		off, err = c.append(ctx, record, acks)
+		return off, false, err
+	}
+
+	if c.isDraining() {
+		return 0, false, errDraining
+	}
+
+	off, err = p.AppendUncommitted(record, acks)
+	return off, err == nil, err
+}
+
+// acknowledge waits for p to be committed if it has to be and sends its
+// response, unless the producer asked for none.
+func (s *grpcServer) acknowledge(ctx context.Context, stream api.Log_ProduceStreamServer, p produced) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	if p.uncommitted {
+		if err := s.CommitLog.(pipelinedAppender).WaitCommitted(ctx, p.off); err != nil {
+			return err
+		}
+	}
+
+	if p.acks == api.Acks_ACKS_NONE {
+		return nil
+	}
+
+	return stream.Send(&api.ProduceResponse{Offset: p.off})
+}
+
+// errNoCredit ends a ConsumeFlow whose client closed its side of the stream
+// and has no credits left to spend.
+var errNoCredit = errors.New("no credit left")
+
+// credit counts the records a ConsumeFlow client will still take.
+type credit struct {
+	mu sync.Mutex
+	n  uint64
+	// granted is closed and replaced whenever credits are granted or the
+	// client stops granting them.
+	granted chan struct{}
+	closed  bool
+}
+
+func newCredit() *credit {
+	return &credit{granted: make(chan struct{})}
+}
+
+// grant adds n credits.
+func (c *credit) grant(n uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.n += uint64(n)
+	close(c.granted)
+	c.granted = make(chan struct{})
+}
+
+// close records that no more credits will be granted.
+func (c *credit) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	close(c.granted)
+	c.granted = make(chan struct{})
+}
+
+// exhausted reports whether every credit is spent and no more will be
+// granted.
+func (c *credit) exhausted() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed && c.n == 0
+}
+
+// take spends a credit, waiting for one to be granted if there are none. It
+// fails with errNoCredit once none are left and none will be granted, and
+// with errDraining once draining is closed.
+func (c *credit) take(ctx context.Context, draining <-chan struct{}) error {
+	for {
+		c.mu.Lock()
+		if c.n > 0 {
+			c.n--
+			c.mu.Unlock()
+			return nil
+		}
+		closed, granted := c.closed, c.granted
+		c.mu.Unlock()
+
+		if closed {
+			return errNoCredit
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-draining:
+			return errDraining
+		case <-granted:
+		}
+	}
+}
+
+// ConsumeFlow follows the log like ConsumeStream, but sends a record only
+// for each credit the client has granted. It ends when the client closes
+// its side of the stream and has spent its credits.
+func (s *grpcServer) ConsumeFlow(stream api.Log_ConsumeFlowServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	req := first.Request
+	if req == nil {
+		return status.Error(codes.InvalidArgument, "the first message needs a request")
+	}
+	if req.ReplicaId != "" {
+		return status.Error(codes.InvalidArgument, "replicas fetch with ConsumeStream")
+	}
+
+	if err = s.authorize(stream.Context(), DefaultTopic, consumeAction); err != nil {
+		return err
+	}
+
+	if err = s.checkConsistency(stream.Context(), req); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	cr := newCredit()
+	cr.grant(first.Credits)
+
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				cr.close()
+				// There's nothing more to send if the credits are spent.
+				if cr.exhausted() {
+					recvErr <- nil
+					cancel()
+				}
+				return
+			}
+			if err != nil {
+				recvErr <- err
+				cancel()
+				return
+			}
+
+			cr.grant(msg.Credits)
+		}
+	}()
+
+	err = s.follow(ctx, req.Offset, func(record *api.Record) error {
+		if err := cr.take(ctx, s.draining()); err != nil {
+			return err
+		}
+
+		if err := stream.Send(&api.ConsumeResponse{Record: record}); err != nil {
+			return err
+		}
+
+		s.observeLag(record.Offset)
+		if cr.exhausted() {
+			return errNoCredit
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errNoCredit):
+		return nil
+	case ctx.Err() != nil && stream.Context().Err() == nil:
+		// The client closed its side of the stream without credits, or
+		// broke it.
+		return <-recvErr
+	default:
+		return err
+	}
+}
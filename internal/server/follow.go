@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/status"
+)
+
+// followPollInterval is how often follow checks for new records in logs that
+// can't notify it of changes.
+var followPollInterval = 100 * time.Millisecond
+
+// follow sends every record from off onwards, waiting for new records once
+// it reaches the end of the log, until ctx is done, send fails or the server
+// drains. Records truncated away before follow reads them are an
+// ErrOffsetOutOfRange.
+func (c *Config) follow(ctx context.Context, off uint64, send func(*api.Record) error) error {
+	var ticker *time.Ticker
+	notifier, ok := c.CommitLog.(changeNotifier)
+	if !ok {
+		ticker = time.NewTicker(followPollInterval)
+		defer ticker.Stop()
+	}
+
+	for {
+		if c.isDraining() {
+			return errDraining
+		}
+
+		var changed <-chan struct{}
+		if notifier != nil {
+			changed = notifier.Changed()
+		}
+
+		record, err := c.CommitLog.Read(off)
+		if err == nil {
+			if err = send(record); err != nil {
+				return err
+			}
+			off++
+			continue
+		}
+
+		if !api.IsOffsetOutOfRange(err) {
+			return err
+		}
+
+		if o, ok := c.CommitLog.(offsetRanger); ok {
+			lowest, err := o.LowestOffset()
+			if err != nil {
+				return err
+			}
+
+			if off < lowest {
+				return api.ErrOffsetOutOfRange{Offset: off}
+			}
+		}
+
+		var tick <-chan time.Time
+		if ticker != nil {
+			tick = ticker.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.draining():
+			return errDraining
+		case <-changed:
+		case <-tick:
+		}
+	}
+}
+
+// readWait reads the record at off. If off is past the end of the log, it
+// waits up to wait for the record to be committed, waking when the log
+// changes. Records truncated away don't come back, so they fail at once.
+func (c *Config) readWait(ctx context.Context, off uint64, wait time.Duration) (*api.Record, error) {
+	record, err := c.CommitLog.Read(off)
+	if wait <= 0 || !api.IsOffsetOutOfRange(err) {
+		return record, err
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var tick <-chan time.Time
+	notifier, ok := c.CommitLog.(changeNotifier)
+	if !ok {
+		ticker := time.NewTicker(followPollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		if o, ok := c.CommitLog.(offsetRanger); ok {
+			lowest, err := o.LowestOffset()
+			if err != nil {
+				return nil, err
+			}
+
+			if off < lowest {
+				return nil, api.ErrOffsetOutOfRange{Offset: off}
+			}
+		}
+
+		var changed <-chan struct{}
+		if notifier != nil {
+			changed = notifier.Changed()
+		}
+
+		// The log may have changed before changed was taken.
+		record, err = c.CommitLog.Read(off)
+		if !api.IsOffsetOutOfRange(err) {
+			return record, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-c.draining():
+			return nil, errDraining
+		case <-timer.C:
+			return nil, err
+		case <-changed:
+		case <-tick:
+		}
+	}
+}
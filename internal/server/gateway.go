@@ -0,0 +1,502 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// gatewayMarshal encodes responses like grpc-gateway does, with zero values
+// included so clients see offset 0.
+var gatewayMarshal = protojson.MarshalOptions{EmitUnpopulated: true}
+
+// gateway serves gRPC services over JSON/HTTP. Routes come from the
+// google.api.http annotations on each method in log.proto, so annotated RPCs
+// are served without handlers of their own. Requests and responses use the
+// protobuf JSON encoding. Calls are observed like gRPC calls, so they're
+// logged, measured and traced under the same method names.
+type gateway struct {
+	mux      *http.ServeMux
+	observer *observer
+}
+
+func newgateway(mux *http.ServeMux, o *observer) *gateway {
+	return &gateway{mux: mux, observer: o}
+}
+
+// registerGateway routes the annotated methods of the Log and Admin services
+// on mux.
+func (s *HTTPServer) registerGateway(mux *http.ServeMux) error {
+	lsrv, err := newgrpcServer(s.Config)
+	if err != nil {
+		return err
+	}
+
+	asrv, err := newadminServer(s.Config)
+	if err != nil {
+		return err
+	}
+
+	g := newgateway(mux, newObserver(s.Config))
+	if err := g.register(&api.Log_ServiceDesc, lsrv); err != nil {
+		return err
+	}
+
+	return g.register(&api.Admin_ServiceDesc, asrv)
+}
+
+// register routes every annotated method of the service described by sd to
+// impl. Unary and server streaming methods are supported; annotating a
+// client streaming method is an error.
+func (g *gateway) register(sd *grpc.ServiceDesc, impl any) error {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(sd.ServiceName))
+	if err != nil {
+		return err
+	}
+	service, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return fmt.Errorf("%s isn't a service", sd.ServiceName)
+	}
+
+	unary := make(map[string]unaryHandler)
+	for _, m := range sd.Methods {
+		unary[m.MethodName] = m.Handler
+	}
+	streams := make(map[string]grpc.StreamHandler)
+	for _, s := range sd.Streams {
+		streams[s.StreamName] = s.Handler
+	}
+
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+
+		rule, ok := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+
+		if md.IsStreamingClient() {
+			return fmt.Errorf("%s: the gateway can't serve client streams", md.FullName())
+		}
+
+		var call gatewayCall
+		if md.IsStreamingServer() {
+			info := &grpc.StreamServerInfo{
+				FullMethod:     "/" + sd.ServiceName + "/" + string(md.Name()),
+				IsServerStream: true,
+			}
+			call = g.streamCall(streams[string(md.Name())], impl, info)
+		} else {
+			call = g.unaryCall(unary[string(md.Name())], impl)
+		}
+
+		for _, r := range append([]*annotations.HttpRule{rule}, rule.AdditionalBindings...) {
+			if err := g.route(md, r, call); err != nil {
+				return fmt.Errorf("%s: %w", md.FullName(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// unaryHandler is the type of grpc.MethodDesc's Handler.
+type unaryHandler = func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error)
+
+// gatewayCall calls a method with the decoded request, writing its response.
+type gatewayCall func(w http.ResponseWriter, r *http.Request, req proto.Message)
+
+func (g *gateway) route(md protoreflect.MethodDescriptor, rule *annotations.HttpRule, call gatewayCall) error {
+	var method, path string
+	switch p := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		method, path = http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		method, path = http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		method, path = http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		method, path = http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		method, path = http.MethodPatch, p.Patch
+	default:
+		return fmt.Errorf("unsupported HTTP pattern %T", p)
+	}
+
+	if rule.ResponseBody != "" {
+		return fmt.Errorf("response_body isn't supported")
+	}
+
+	pattern, vars, err := parsePathTemplate(path)
+	if err != nil {
+		return err
+	}
+
+	input, err := protoregistry.GlobalTypes.FindMessageByName(md.Input().FullName())
+	if err != nil {
+		return err
+	}
+
+	g.mux.HandleFunc(method+" "+pattern, func(w http.ResponseWriter, r *http.Request) {
+		req := input.New().Interface()
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		if err := decodeGatewayRequest(r, rule.Body, vars, req); err != nil {
+			httpError(w, err)
+			return
+		}
+
+		call(w, r.WithContext(gatewayContext(r)), req)
+	})
+
+	return nil
+}
+
+// parsePathTemplate turns a path template such as /v1/log/records/{offset}
+// into a ServeMux pattern, returning the field each wildcard binds. Variables
+// must be whole path segments. Templates match whole paths, so a trailing
+// slash doesn't make the pattern match everything under it.
+func parsePathTemplate(path string) (pattern string, vars map[string]string, err error) {
+	vars = make(map[string]string)
+
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		if !strings.ContainsAny(seg, "{}") {
+			continue
+		}
+
+		field, ok := strings.CutPrefix(seg, "{")
+		if ok {
+			field, ok = strings.CutSuffix(field, "}")
+		}
+		if !ok || strings.ContainsAny(field, "{}=*") {
+			return "", nil, fmt.Errorf("unsupported path template %q", path)
+		}
+
+		name := strings.ReplaceAll(field, ".", "_")
+		vars[name] = field
+		segments[i] = "{" + name + "}"
+	}
+
+	pattern = strings.Join(segments, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "{$}"
+	}
+
+	return pattern, vars, nil
+}
+
+// decodeGatewayRequest fills in req from the request body, the path
+// variables and then the query string, which sets any field not already
+// bound.
+func decodeGatewayRequest(r *http.Request, body string, vars map[string]string, req proto.Message) error {
+	if body != "" {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return bodyError(err)
+		}
+
+		if len(b) > 0 {
+			target := req
+			if body != "*" {
+				fd := findField(req.ProtoReflect().Descriptor(), body)
+				if fd == nil || fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+					return status.Errorf(codes.Internal, "invalid body field %q", body)
+				}
+				target = req.ProtoReflect().Mutable(fd).Message().Interface()
+			}
+
+			if err := protojson.Unmarshal(b, target); err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+	}
+
+	m := req.ProtoReflect()
+	for name, field := range vars {
+		if err := setField(m, field, []string{r.PathValue(name)}); err != nil {
+			return err
+		}
+	}
+
+	if body == "*" {
+		return nil
+	}
+
+	for key, values := range r.URL.Query() {
+		if err := setField(m, key, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findField looks up a field by its proto or JSON name.
+func findField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+
+	return md.Fields().ByJSONName(name)
+}
+
+// setField sets the field at the dotted path, such as record.value, from
+// string values as they appear in paths and query strings.
+func setField(m protoreflect.Message, path string, values []string) error {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		fd := findField(m.Descriptor(), part)
+		if fd == nil {
+			return status.Errorf(codes.InvalidArgument, "unknown field %q", path)
+		}
+
+		if i < len(parts)-1 {
+			if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+				return status.Errorf(codes.InvalidArgument, "field %q isn't a message", part)
+			}
+			m = m.Mutable(fd).Message()
+			continue
+		}
+
+		switch {
+		case fd.IsMap():
+			return status.Errorf(codes.InvalidArgument, "map field %q can't be set from a string", path)
+		case fd.IsList():
+			list := m.Mutable(fd).List()
+			for _, v := range values {
+				if fd.Kind() == protoreflect.MessageKind {
+					return status.Errorf(codes.InvalidArgument, "repeated message field %q can't be set from a string", path)
+				}
+				val, err := parseScalar(fd, v)
+				if err != nil {
+					return err
+				}
+				list.Append(val)
+			}
+		case len(values) != 1:
+			return status.Errorf(codes.InvalidArgument, "field %q takes one value", path)
+		case fd.Kind() == protoreflect.MessageKind:
+			// Well-known types such as Duration have a string JSON form.
+			msg := m.Mutable(fd).Message().Interface()
+			if err := protojson.Unmarshal([]byte(strconv.Quote(values[0])), msg); err != nil {
+				return status.Errorf(codes.InvalidArgument, "invalid value for %q: %v", path, err)
+			}
+		default:
+			val, err := parseScalar(fd, values[0])
+			if err != nil {
+				return err
+			}
+			m.Set(fd, val)
+		}
+	}
+
+	return nil
+}
+
+func parseScalar(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	invalid := func(err error) (protoreflect.Value, error) {
+		return protoreflect.Value{}, status.Errorf(codes.InvalidArgument, "invalid value for %q: %v", fd.Name(), err)
+	}
+
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfBool(v), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfInt32(int32(v)), nil
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfInt64(v), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfUint32(uint32(v)), nil
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfUint64(v), nil
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfFloat32(float32(v)), nil
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		return protoreflect.ValueOfFloat64(v), nil
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		v, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			if v, err = base64.URLEncoding.DecodeString(s); err != nil {
+				return invalid(err)
+			}
+		}
+		return protoreflect.ValueOfBytes(v), nil
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return invalid(fmt.Errorf("unknown enum value %q", s))
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+	}
+
+	return invalid(fmt.Errorf("unsupported kind %s", fd.Kind()))
+}
+
+// gatewayContext gives a call the peer and traceparent the observer reads
+// from gRPC calls.
+func gatewayContext(r *http.Request) context.Context {
+	ctx := r.Context()
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	if v := r.Header.Get("traceparent"); v != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("traceparent", v))
+	}
+
+	return ctx
+}
+
+func (g *gateway) unaryCall(handler unaryHandler, impl any) gatewayCall {
+	return func(w http.ResponseWriter, r *http.Request, req proto.Message) {
+		dec := func(v any) error {
+			proto.Merge(v.(proto.Message), req)
+			return nil
+		}
+
+		resp, err := handler(impl, r.Context(), dec, g.observer.unary)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		b, err := gatewayMarshal.Marshal(resp.(proto.Message))
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}
+}
+
+// streamCall serves a server stream as newline-delimited JSON, one message
+// per line. An error after the first message is sent as a final line shaped
+// like ErrorResponse.
+func (g *gateway) streamCall(handler grpc.StreamHandler, impl any, info *grpc.StreamServerInfo) gatewayCall {
+	return func(w http.ResponseWriter, r *http.Request, req proto.Message) {
+		stream := &gatewayStream{
+			ctx: r.Context(),
+			w:   w,
+			rc:  http.NewResponseController(w),
+			req: req,
+		}
+
+		err := g.observer.stream(impl, stream, info, handler)
+		switch {
+		case err == nil:
+			if !stream.sent {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				w.WriteHeader(http.StatusOK)
+			}
+		case !stream.sent:
+			httpError(w, err)
+		default:
+			b, _ := json.Marshal(errorResponse(err))
+			w.Write(append(b, '\n'))
+		}
+	}
+}
+
+// gatewayStream is the grpc.ServerStream a server stream handler gets from
+// the gateway. It receives the decoded request once and writes each message
+// it sends to the response.
+type gatewayStream struct {
+	ctx  context.Context
+	w    http.ResponseWriter
+	rc   *http.ResponseController
+	req  proto.Message
+	recv bool
+	sent bool
+}
+
+var _ grpc.ServerStream = (*gatewayStream)(nil)
+
+func (s *gatewayStream) SetHeader(metadata.MD) error  { return nil }
+func (s *gatewayStream) SendHeader(metadata.MD) error { return nil }
+func (s *gatewayStream) SetTrailer(metadata.MD)       {}
+
+func (s *gatewayStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *gatewayStream) SendMsg(m any) error {
+	b, err := gatewayMarshal.Marshal(m.(proto.Message))
+	if err != nil {
+		return err
+	}
+
+	if !s.sent {
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+		s.w.WriteHeader(http.StatusOK)
+		s.sent = true
+	}
+
+	if _, err = s.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	return s.rc.Flush()
+}
+
+func (s *gatewayStream) RecvMsg(m any) error {
+	if s.recv {
+		return io.EOF
+	}
+	s.recv = true
+
+	proto.Merge(m.(proto.Message), s.req)
+	return nil
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// healthWatchInterval is how often Watch rechecks the server's health.
+var healthWatchInterval = time.Second
+
+// closedChecker is implemented by commit logs that know whether they've been
+// closed, such as *log.Log.
+type closedChecker interface {
+	Closed() bool
+}
+
+// changeNotifier is implemented by commit logs that can wake waiters when
+// they change, such as *log.Log.
+type changeNotifier interface {
+	Changed() <-chan struct{}
+}
+
+// healthServer implements the standard gRPC health service. The server is
+// serving while its log is open and it isn't draining and, if it's a
+// follower, while it hears from its leader.
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	*Config
+}
+
+func newhealthServer(cfg *Config) *healthServer {
+	return &healthServer{Config: cfg}
+}
+
+func (s *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, err := s.status(req.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch sends the service's status and then every change to it until the
+// client goes away, or until the server drains, after reporting NOT_SERVING.
+func (s *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ticker := time.NewTicker(healthWatchInterval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		var changed <-chan struct{}
+		if n, ok := s.CommitLog.(changeNotifier); ok {
+			changed = n.Changed()
+		}
+
+		// The spec has Watch report unknown services rather than fail.
+		st, err := s.status(req.Service)
+		if err != nil {
+			st = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+
+		if st != last {
+			if err = stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+
+		if s.isDraining() {
+			return nil
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.draining():
+		case <-changed:
+		case <-ticker.C:
+		}
+	}
+}
+
+// status works out the serving status of service, where "" is the server as
+// a whole.
+func (s *healthServer) status(service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	switch service {
+	case "", api.Log_ServiceDesc.ServiceName, api.Admin_ServiceDesc.ServiceName:
+	default:
+		return 0, status.Errorf(codes.NotFound, "unknown service %q", service)
+	}
+
+	if s.isDraining() {
+		return healthpb.HealthCheckResponse_NOT_SERVING, nil
+	}
+
+	if c, ok := s.CommitLog.(closedChecker); ok && c.Closed() {
+		return healthpb.HealthCheckResponse_NOT_SERVING, nil
+	}
+
+	if r, ok := s.CommitLog.(Replica); ok && !r.IsLeader() {
+		if time.Since(r.LastContact()) > s.leaderTimeout() {
+			return healthpb.HealthCheckResponse_NOT_SERVING, nil
+		}
+	}
+
+	return healthpb.HealthCheckResponse_SERVING, nil
+}
+
+func (s *healthServer) leaderTimeout() time.Duration {
+	if s.LeaderTimeout == 0 {
+		return 10 * time.Second
+	}
+
+	return s.LeaderTimeout
+}
@@ -4,91 +4,168 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// httpReadHeaderTimeout bounds how long a client may take to send a
+// request's headers.
+const httpReadHeaderTimeout = 10 * time.Second
+
+// maxBodyBytes bounds request bodies like the gRPC server's default limit on
+// the messages it receives.
+const maxBodyBytes = 4 << 20
+
+// HTTPServer serves the JSON/HTTP API from the same commit log as the gRPC
+// server.
 type HTTPServer struct {
-	Log *Log
+	*Config
 }
 
-func newHTTPServer() *HTTPServer {
+func newHTTPServer(cfg *Config) *HTTPServer {
 	return &HTTPServer{
-		NewLog(),
+		Config: cfg,
 	}
 }
 
-func NewHTTPServer(addr string) *http.Server {
-	srv := newHTTPServer()
+// NewHTTPServer creates the JSON/HTTP server. Besides its own routes it
+// serves the RPCs annotated in log.proto through the gateway. Requests are
+// authenticated and authorized with cfg's Authenticator and Authorizer, like
+// gRPC calls. If cfg has metrics, they're served unauthenticated at /metrics
+// for Prometheus.
+func NewHTTPServer(addr string, cfg *Config) *http.Server {
+	srv := newHTTPServer(cfg)
 	r := http.NewServeMux()
 
-	r.HandleFunc("POST /", srv.handleProduce)
-	r.HandleFunc("GET /", srv.handleConsume)
+	r.HandleFunc("POST /v1/topics/{topic}/records", srv.handleProduceRecord)
+	r.HandleFunc("GET /v1/topics/{topic}/records", srv.handleConsumeRange)
+	r.HandleFunc("GET /v1/topics/{topic}/records/{offset}", srv.handleConsumeRecord)
+	r.HandleFunc("GET /v1/topics/{topic}/events", srv.handleTail)
+	r.HandleFunc("GET /v1/topics/{topic}/ws", srv.handleWebSocket)
 
+	// The gateway's routes come from log.proto, so failing to register
+	// them is a bug, like a conflicting pattern is to the mux.
+	if err := srv.registerGateway(r); err != nil {
+		panic(err)
+	}
+
+	root := http.NewServeMux()
+	root.Handle("/", cfg.authenticateHTTP(r))
+	if cfg.Metrics != nil {
+		root.Handle("GET /metrics", cfg.Metrics.Handler())
+	}
+
+	// Streams can stay open indefinitely, so only reading the headers is
+	// bounded, which stops clients holding connections open by trickling
+	// them.
 	return &http.Server{
-		Addr:    addr,
-		Handler: r,
+		Addr:              addr,
+		Handler:           root,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
 	}
 }
 
-type ProduceRequest struct {
-	Record Record `json:"record"`
+// Record is a record as the JSON API sends and receives it. The value is
+// base64 encoded.
+type Record struct {
+	Value  []byte `json:"value"`
+	Offset uint64 `json:"offset"`
 }
 
-type ProduceResponse struct {
-	Offset uint64 `json:"offset"`
+// httpStatus maps gRPC codes to the HTTP statuses that mean the same thing.
+var httpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusPreconditionFailed,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusNotFound,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.Unauthenticated:    http.StatusUnauthorized,
 }
 
-type ConsumeRequest struct {
-	Offset uint64 `json:"offset"`
+// ErrorResponse is the body of every HTTP error, shaped like Google API
+// errors.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
 }
 
-type ConsumeResponse struct {
-	Record Record `json:"record"`
+type ErrorBody struct {
+	// Code is the HTTP status code.
+	Code int `json:"code"`
+	// Status is the gRPC code's name, such as OUT_OF_RANGE.
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Reason is the ErrorInfo reason of errors from the log, such as
+	// OFFSET_OUT_OF_RANGE.
+	Reason string `json:"reason,omitempty"`
 }
 
-func (s *HTTPServer) handleProduce(w http.ResponseWriter, r *http.Request) {
-	var req ProduceRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// bodyError is the error for a request body that couldn't be read or
+// decoded, saying so if it was larger than maxBodyBytes.
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return status.Errorf(codes.InvalidArgument, "request body larger than %d bytes", tooLarge.Limit)
 	}
 
-	offset, err := s.Log.Append(req.Record)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	return status.Error(codes.InvalidArgument, err.Error())
+}
 
-	resp := ProduceResponse{Offset: offset}
-	err = json.NewEncoder(w).Encode(resp)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+// httpError writes err as a JSON error with the HTTP status matching its
+// gRPC code.
+func httpError(w http.ResponseWriter, err error) {
+	res := errorResponse(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(res.Error.Code)
+	json.NewEncoder(w).Encode(res)
 }
 
-func (s *HTTPServer) handleConsume(w http.ResponseWriter, r *http.Request) {
-	var req ConsumeRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+func errorResponse(err error) ErrorResponse {
+	st := status.Convert(err)
+
+	code, ok := httpStatus[st.Code()]
+	if !ok {
+		code = http.StatusInternalServerError
 	}
 
-	record, err := s.Log.Read(req.Offset)
-	if err != nil {
-		if errors.Is(err, ErrOffsetNotFound) {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	body := ErrorBody{
+		Code:    code,
+		Status:  codeName(st.Code()),
+		Message: st.Message(),
 	}
+	if info := api.ErrorInfo(err); info != nil {
+		body.Reason = info.Reason
+	}
+
+	return ErrorResponse{Error: body}
+}
 
-	resp := ConsumeResponse{Record: record}
-	err = json.NewEncoder(w).Encode(resp)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// codeName turns a gRPC code's name, such as OutOfRange, into the form used
+// in JSON, such as OUT_OF_RANGE.
+func codeName(c codes.Code) string {
+	var b strings.Builder
+	var prev rune
+	for _, r := range c.String() {
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+		prev = r
 	}
+
+	return b.String()
 }
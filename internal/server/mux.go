@@ -0,0 +1,244 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// RaftRPC is the first byte a node writes on a connection to mark it as
+// Raft traffic. TLS handshakes, which both gRPC and HTTP/2 connections start
+// with, always begin with 0x16, so the two can share a port.
+const RaftRPC = 1
+
+// muxReadTimeout bounds how long the Mux waits for a new connection's first
+// byte before dropping it.
+const muxReadTimeout = 10 * time.Second
+
+var ErrMuxClosed = errors.New("mux: listener closed")
+
+// Mux accepts connections on a single listener and routes each one to the
+// Raft or gRPC listener depending on its first byte, so a node only has to
+// open one port.
+type Mux struct {
+	ln   net.Listener
+	raft *muxListener
+	grpc *muxListener
+
+	closeOnce sync.Once
+}
+
+// NewMux creates a Mux on top of ln. Call Serve to start routing
+// connections.
+func NewMux(ln net.Listener) *Mux {
+	return &Mux{
+		ln:   ln,
+		raft: newMuxListener(ln.Addr()),
+		grpc: newMuxListener(ln.Addr()),
+	}
+}
+
+// RaftListener returns the listener that receives connections whose first
+// byte is RaftRPC.
+func (m *Mux) RaftListener() net.Listener {
+	return m.raft
+}
+
+// GRPCListener returns the listener that receives every other connection.
+func (m *Mux) GRPCListener() net.Listener {
+	return m.grpc
+}
+
+// Serve accepts connections until the underlying listener is closed.
+func (m *Mux) Serve() error {
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			m.Close()
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		// We peek in a goroutine so a client that never writes can't stall
+		// the accept loop.
+		go m.route(conn)
+	}
+}
+
+func (m *Mux) route(conn net.Conn) {
+	if err := conn.SetReadDeadline(time.Now().Add(muxReadTimeout)); err != nil {
+		conn.Close()
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	b, err := r.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	if err = conn.SetReadDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return
+	}
+
+	// We hand the connection on with the peeked byte still unread so the
+	// listener's owner sees the stream exactly as the client sent it.
+	c := &muxConn{Conn: conn, r: r}
+	if bytes.Equal(b, []byte{RaftRPC}) {
+		m.raft.deliver(c)
+		return
+	}
+	m.grpc.deliver(c)
+}
+
+// Close closes the underlying listener and both routed listeners.
+func (m *Mux) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		err = m.ln.Close()
+		m.raft.Close()
+		m.grpc.Close()
+	})
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// muxConn is a net.Conn whose reads first drain the bytes the Mux peeked.
+type muxConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *muxConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// muxListener is a net.Listener fed by the Mux instead of the network.
+type muxListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newMuxListener(addr net.Addr) *muxListener {
+	return &muxListener{
+		addr:  addr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *muxListener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, ErrMuxClosed
+	}
+}
+
+func (l *muxListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *muxListener) Addr() net.Addr {
+	return l.addr
+}
+
+// StreamLayer carries Raft traffic over the Mux's Raft listener. Outgoing
+// connections write the RaftRPC byte and then upgrade to TLS, and incoming
+// ones check the byte before doing the same, so Raft is encrypted with the
+// same certificates as gRPC. Its methods mirror raft.StreamLayer.
+type StreamLayer struct {
+	ln              net.Listener
+	serverTLSConfig *tls.Config
+	peerTLSConfig   *tls.Config
+}
+
+// NewStreamLayer creates a StreamLayer accepting on ln, usually
+// Mux.RaftListener. Either TLS config may be nil to disable TLS in that
+// direction.
+func NewStreamLayer(ln net.Listener, serverTLSConfig, peerTLSConfig *tls.Config) *StreamLayer {
+	return &StreamLayer{
+		ln:              ln,
+		serverTLSConfig: serverTLSConfig,
+		peerTLSConfig:   peerTLSConfig,
+	}
+}
+
+// Dial makes an outgoing Raft connection to another node's Mux.
+func (s *StreamLayer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// We identify the connection as Raft so the Mux routes it to us.
+	if _, err = conn.Write([]byte{RaftRPC}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.peerTLSConfig != nil {
+		conn = tls.Client(conn, s.peerTLSConfig)
+	}
+
+	return conn, nil
+}
+
+// Accept waits for the next incoming Raft connection.
+func (s *StreamLayer) Accept() (net.Conn, error) {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 1)
+	if _, err = io.ReadFull(conn, b); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !bytes.Equal(b, []byte{RaftRPC}) {
+		conn.Close()
+		return nil, fmt.Errorf("not a raft rpc")
+	}
+
+	if s.serverTLSConfig != nil {
+		return tls.Server(conn, s.serverTLSConfig), nil
+	}
+
+	return conn, nil
+}
+
+func (s *StreamLayer) Close() error {
+	return s.ln.Close()
+}
+
+func (s *StreamLayer) Addr() net.Addr {
+	return s.ln.Addr()
+}
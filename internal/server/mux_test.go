@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/config"
+	"github.com/petrostrak/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// TestMux tests that Raft and gRPC traffic can share one listener, each over
+// TLS.
+func TestMux(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	mux := NewMux(ln)
+	defer mux.Close()
+
+	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:      config.ServerCertFile,
+		KeyFile:       config.ServerKeyFile,
+		CAFile:        config.CAFile,
+		ServerAddress: "127.0.0.1",
+		Server:        true,
+	})
+	require.NoError(t, err)
+
+	peerTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:      config.ClientCertFile,
+		KeyFile:       config.ClientKeyFile,
+		CAFile:        config.CAFile,
+		ServerAddress: "127.0.0.1",
+	})
+	require.NoError(t, err)
+
+	dir, err := os.MkdirTemp("", "mux-test")
+	require.NoError(t, err)
+
+	clog, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+	defer clog.Remove()
+
+	gsrv, err := NewGRPCServer(
+		&Config{CommitLog: clog},
+		grpc.Creds(credentials.NewTLS(serverTLSConfig)),
+	)
+	require.NoError(t, err)
+	defer gsrv.Stop()
+
+	go gsrv.Serve(mux.GRPCListener())
+	go mux.Serve()
+
+	stream := NewStreamLayer(mux.RaftListener(), serverTLSConfig, peerTLSConfig)
+
+	// Raft: echo a message back over the stream layer.
+	go func() {
+		conn, err := stream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	conn, err := stream.Dial(ln.Addr().String(), time.Second)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	want := []byte("hello raft")
+	_, err = conn.Write(want)
+	require.NoError(t, err)
+
+	got := make([]byte, len(want))
+	_, err = io.ReadFull(conn, got)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// gRPC: produce and consume on the same address.
+	cc, err := grpc.NewClient(
+		ln.Addr().String(),
+		grpc.WithTransportCredentials(credentials.NewTLS(peerTLSConfig)),
+	)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	client := api.NewLogClient(cc)
+	ctx := context.Background()
+
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello grpc")},
+	})
+	require.NoError(t, err)
+
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{
+		Offset: produce.Offset,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello grpc"), consume.Record.Value)
+}
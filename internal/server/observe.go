@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/petrostrak/proglog/internal/metrics"
+	"github.com/petrostrak/proglog/internal/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// observer is the outermost interceptor. It traces every call, counts it
+// and its latency, and writes an access log line when it's done.
+type observer struct {
+	logger  *slog.Logger
+	tracer  *trace.Tracer
+	handled *metrics.Counter
+	latency *metrics.Histogram
+	streams *metrics.Gauge
+}
+
+func newObserver(cfg *Config) *observer {
+	o := &observer{
+		logger: cfg.Logger,
+		tracer: cfg.Tracer,
+	}
+	if o.logger == nil {
+		o.logger = slog.Default()
+	}
+
+	if cfg.Metrics != nil {
+		o.handled = cfg.Metrics.Counter(
+			"grpc_server_handled_total",
+			"RPCs completed on the server, by method and status code.",
+			"method",
+			"code",
+		)
+		o.latency = cfg.Metrics.Histogram(
+			"grpc_server_handling_seconds",
+			"Time taken to complete RPCs on the server, by method.",
+			metrics.DefaultBuckets,
+			"method",
+		)
+		o.streams = cfg.Metrics.Gauge(
+			"proglog_server_active_streams",
+			"Streaming RPCs in progress, by method.",
+			"method",
+		)
+	}
+
+	return o
+}
+
+// call collects what the access log reports about a call as the inner
+// interceptors learn it.
+type call struct {
+	subject string
+}
+
+type callContextKey struct{}
+
+// setCallSubject records who made the call in ctx, for the access log.
+func setCallSubject(ctx context.Context, subject string) {
+	if c, ok := ctx.Value(callContextKey{}).(*call); ok {
+		c.subject = subject
+	}
+}
+
+// start begins observing a call to method. The returned function finishes
+// it with the handler's error.
+func (o *observer) start(ctx context.Context, method string) (context.Context, func(error)) {
+	begin := time.Now()
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("traceparent"); len(v) > 0 {
+			if sc, err := trace.ParseTraceparent(v[0]); err == nil {
+				ctx = trace.WithRemoteParent(ctx, sc)
+			}
+		}
+	}
+
+	ctx, span := o.tracer.Start(ctx, method)
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.method", method)
+
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+		span.SetAttribute("net.peer.addr", addr)
+	}
+
+	// HTTP callers are authenticated before their calls are observed.
+	c := &call{subject: principal(ctx).Subject}
+	ctx = context.WithValue(ctx, callContextKey{}, c)
+
+	return ctx, func(err error) {
+		elapsed := time.Since(begin)
+		code := status.Code(err)
+
+		if o.handled != nil {
+			o.handled.Inc(method, code.String())
+			o.latency.Observe(elapsed.Seconds(), method)
+		}
+
+		span.SetAttribute("rpc.grpc.status_code", code.String())
+		if c.subject != "" {
+			span.SetAttribute("enduser.id", c.subject)
+		}
+		if code == codes.OK {
+			span.SetStatus(trace.StatusOK, "")
+		} else {
+			span.SetStatus(trace.StatusError, status.Convert(err).Message())
+		}
+		if err := span.End(); err != nil {
+			o.logger.Error("failed to export span", "error", err)
+		}
+
+		level := slog.LevelInfo
+		attrs := []slog.Attr{
+			slog.String("method", method),
+			slog.String("code", code.String()),
+			slog.Duration("duration", elapsed),
+			slog.String("peer", addr),
+			slog.String("subject", c.subject),
+			slog.String("trace_id", span.SpanContext().TraceIDString()),
+		}
+		if err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+		}
+		o.logger.LogAttrs(ctx, level, "rpc", attrs...)
+	}
+}
+
+func (o *observer) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, done := o.start(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	done(err)
+
+	return resp, err
+}
+
+func (o *observer) stream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if o.streams != nil {
+		o.streams.Add(1, info.FullMethod)
+		defer o.streams.Add(-1, info.FullMethod)
+	}
+
+	ctx, done := o.start(stream.Context(), info.FullMethod)
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	done(err)
+
+	return err
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// readRange reads up to maxRecords records from from, stopping before end if
+// it's set and otherwise at the end of the log. Once the values read add up
+// to maxBytes, if it's set, the next record that would go over is left for
+// the next batch. It returns the records and the offset after the last one.
+// Reading from before the start of the log is an error, not the end.
+func (c *Config) readRange(from, end uint64, maxRecords int, maxBytes uint64) ([]*api.Record, uint64, error) {
+	if o, ok := c.CommitLog.(offsetRanger); ok {
+		lowest, err := o.LowestOffset()
+		if err != nil {
+			return nil, from, err
+		}
+
+		if from < lowest {
+			return nil, from, api.ErrOffsetOutOfRange{Offset: from}
+		}
+	}
+
+	var (
+		records []*api.Record
+		size    uint64
+	)
+	next := from
+	for len(records) < maxRecords && (end == 0 || next < end) {
+		record, err := c.CommitLog.Read(next)
+		if api.IsOffsetOutOfRange(err) {
+			break
+		}
+		if err != nil {
+			return nil, from, err
+		}
+
+		size += uint64(len(record.Value))
+		if maxBytes > 0 && size > maxBytes && len(records) > 0 {
+			break
+		}
+
+		records = append(records, record)
+		next++
+	}
+
+	return records, next, nil
+}
+
+// ConsumeRange reads a batch of records once the log satisfies the request's
+// consistency level.
+func (s *grpcServer) ConsumeRange(ctx context.Context, req *api.ConsumeRangeRequest) (*api.ConsumeRangeResponse, error) {
+	if err := s.authorize(ctx, DefaultTopic, consumeAction); err != nil {
+		return nil, err
+	}
+
+	maxRecords := req.MaxRecords
+	if maxRecords == 0 {
+		maxRecords = defaultRangeLimit
+	}
+	if maxRecords > maxRangeLimit {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"max_records must be at most %d",
+			maxRangeLimit,
+		)
+	}
+
+	if req.EndOffset != 0 && req.EndOffset <= req.From {
+		return nil, status.Error(codes.InvalidArgument, "end_offset must be after from")
+	}
+
+	err := s.checkConsistency(ctx, &api.ConsumeRequest{
+		Offset:       req.From,
+		Consistency:  req.Consistency,
+		MaxStaleness: req.MaxStaleness,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records, next, err := s.readRange(req.From, req.EndOffset, int(maxRecords), req.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &api.ConsumeRangeResponse{Records: records, NextOffset: next}
+	if h, ok := s.CommitLog.(highWatermarker); ok {
+		resp.HighWatermark = h.HighWatermark()
+	}
+
+	return resp, nil
+}
+
+// consumeToHighWatermark sends the records from req's offset up to the
+// high-water mark as of the call, then ends the stream. Logs without a
+// high-water mark are read until the end.
+func (s *grpcServer) consumeToHighWatermark(req *api.ConsumeRequest, stream api.Log_ConsumeStreamServer) error {
+	var end uint64
+	h, bounded := s.CommitLog.(highWatermarker)
+	if bounded {
+		end = h.HighWatermark()
+	}
+
+	for off := req.Offset; !bounded || off < end; off++ {
+		if s.isDraining() {
+			return errDraining
+		}
+
+		resp, err := s.read(off)
+		if !bounded && api.IsOffsetOutOfRange(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = stream.Send(resp); err != nil {
+			return err
+		}
+
+		s.observeLag(off)
+	}
+
+	return nil
+}
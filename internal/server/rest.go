@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultTopic is the only topic the server has. The REST API names topics
+// so more can be added without changing its routes, and calls on the log are
+// authorized on the topic.
+const DefaultTopic = "default"
+
+const (
+	defaultRangeLimit = 100
+	maxRangeLimit     = 1000
+)
+
+// ProduceRecordRequest is the body of POST /v1/topics/{topic}/records.
+type ProduceRecordRequest struct {
+	Value []byte   `json:"value"`
+	Acks  api.Acks `json:"acks,omitempty"`
+}
+
+// ProduceResponse is the body of a successful produce.
+type ProduceResponse struct {
+	Offset uint64 `json:"offset"`
+}
+
+// RecordsResponse is a page of records. NextOffset is where the next page
+// starts.
+type RecordsResponse struct {
+	Records    []Record `json:"records"`
+	NextOffset uint64   `json:"next_offset"`
+}
+
+// topic checks the request's topic exists.
+func topic(r *http.Request) error {
+	if t := r.PathValue("topic"); t != DefaultTopic {
+		return api.ErrTopicNotFound{Topic: t}
+	}
+
+	return nil
+}
+
+// handleProduceRecord appends the record in the body and responds with its
+// offset and location.
+func (s *HTTPServer) handleProduceRecord(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r.Context(), DefaultTopic, produceAction); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	if err := topic(r); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	var req ProduceRecordRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpError(w, bodyError(err))
+		return
+	}
+
+	offset, err := s.append(r.Context(), &api.Record{Value: req.Value}, req.Acks)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	w.Header().Set(
+		"Location",
+		fmt.Sprintf("/v1/topics/%s/records/%d", r.PathValue("topic"), offset),
+	)
+	writeJSON(w, http.StatusCreated, ProduceResponse{Offset: offset})
+}
+
+// handleConsumeRecord responds with the record at the offset in the path.
+func (s *HTTPServer) handleConsumeRecord(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r.Context(), DefaultTopic, consumeAction); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	if err := topic(r); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	offset, err := strconv.ParseUint(r.PathValue("offset"), 10, 64)
+	if err != nil {
+		httpError(w, status.Errorf(codes.InvalidArgument, "invalid offset: %q", r.PathValue("offset")))
+		return
+	}
+
+	record, err := s.CommitLog.Read(offset)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, Record{Value: record.Value, Offset: record.Offset})
+}
+
+// handleConsumeRange responds with up to limit records starting at from.
+// A page ends early at the end of the log, so an empty page means the
+// consumer has caught up.
+func (s *HTTPServer) handleConsumeRange(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r.Context(), DefaultTopic, consumeAction); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	if err := topic(r); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	from, err := queryUint(r, "from", 0)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	limit, err := queryUint(r, "limit", defaultRangeLimit)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	if limit == 0 || limit > maxRangeLimit {
+		httpError(w, status.Errorf(
+			codes.InvalidArgument,
+			"limit must be between 1 and %d",
+			maxRangeLimit,
+		))
+		return
+	}
+
+	records, next, err := s.readRange(from, 0, int(limit), 0)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	res := RecordsResponse{Records: []Record{}, NextOffset: next}
+	for _, record := range records {
+		res.Records = append(res.Records, Record{Value: record.Value, Offset: record.Offset})
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// queryUint parses the query parameter name, which defaults to def.
+func queryUint(r *http.Request, name string, def uint64) (uint64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid %s: %q", name, v)
+	}
+
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
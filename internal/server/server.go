@@ -2,9 +2,18 @@ package server
 
 import (
 	"context"
+	"log/slog"
+	"sync"
+	"time"
 
 	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/metrics"
+	"github.com/petrostrak/proglog/internal/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type CommitLog interface {
@@ -12,15 +21,77 @@ type CommitLog interface {
 	Read(uint64) (*api.Record, error)
 }
 
+// GetServerer describes the servers that make up the deployment. A
+// replicated backend implements it; when Config.GetServerer is nil the
+// server describes itself as a single node leading its own log.
+type GetServerer interface {
+	GetServers() ([]*api.Server, error)
+}
+
+// ackAppender is implemented by replicated commit logs that can wait for the
+// acknowledgements a producer asks for.
+type ackAppender interface {
+	AppendAcks(context.Context, *api.Record, api.Acks) (uint64, error)
+}
+
+// replicaFetcher is implemented by commit logs that lead in-sync replicas.
+// It serves ConsumeStream requests that carry a replica ID.
+type replicaFetcher interface {
+	Fetch(ctx context.Context, replicaID string, off uint64, send func(*api.ConsumeResponse) error) error
+}
+
 type Config struct {
-	CommitLog CommitLog
+	CommitLog   CommitLog
+	GetServerer GetServerer
+	// Authorizer checks every call against the caller's subject. A nil
+	// Authorizer allows everything.
+	Authorizer Authorizer
+	// Authenticator, if set, accepts bearer tokens or API keys in place of
+	// a client certificate.
+	Authenticator Authenticator
+	// ServerID and RPCAddr identify this node in GetServers responses.
+	ServerID string
+	RPCAddr  string
+	// Logger writes an access log line for every call. It defaults to
+	// slog.Default().
+	Logger *slog.Logger
+	// Metrics, if set, counts calls and their latency by method.
+	Metrics *metrics.Registry
+	// Tracer, if set, exports a span for every call.
+	Tracer *trace.Tracer
+	// LeaderTimeout is how long a follower may go without hearing from its
+	// leader before it reports itself as not serving. It defaults to 10s.
+	LeaderTimeout time.Duration
+	// Reflection registers the gRPC reflection service so tools such as
+	// grpcurl can discover the API.
+	Reflection bool
+	// WebSocketOrigins are the origins, such as https://app.example.com,
+	// whose pages may open WebSockets besides the server's own.
+	WebSocketOrigins []string
+
+	// drained is closed by Drain.
+	drainMu sync.Mutex
+	drained chan struct{}
 }
 
 var _ api.LogServer = (*grpcServer)(nil)
 
+// maxConsumeWait caps a Consume's max_wait, so a long poll doesn't hold a
+// call open indefinitely.
+var maxConsumeWait = 30 * time.Second
+
 // NewGRPCServer instantiates the service, creates a gRPC server and
-// registers the service to that server.
+// registers the service to that server, along with the admin and health
+// services. Every call is logged, measured and traced, then authenticated
+// from its bearer credential or client certificate, before the caller's
+// interceptors run.
 func NewGRPCServer(cfg *Config, opts ...grpc.ServerOption) (*grpc.Server, error) {
+	o := newObserver(cfg)
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(o.unary, cfg.authenticateUnary),
+		grpc.ChainStreamInterceptor(o.stream, cfg.authenticateStream),
+	}, opts...)
+
 	gsrv := grpc.NewServer(opts...)
 	srv, err := newgrpcServer(cfg)
 	if err != nil {
@@ -28,24 +99,59 @@ func NewGRPCServer(cfg *Config, opts ...grpc.ServerOption) (*grpc.Server, error)
 	}
 
 	api.RegisterLogServer(gsrv, srv)
+
+	asrv, err := newadminServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	api.RegisterAdminServer(gsrv, asrv)
+	healthpb.RegisterHealthServer(gsrv, newhealthServer(cfg))
+
+	if cfg.Reflection {
+		reflection.Register(gsrv)
+	}
+
 	return gsrv, nil
 }
 
 type grpcServer struct {
 	api.UnimplementedLogServer
 	*Config
+
+	// consumerLag, if the server has metrics, records how far behind the
+	// high-water mark consume streams are as they send each record.
+	consumerLag *metrics.Histogram
 }
 
 func newgrpcServer(cfg *Config) (srv *grpcServer, err error) {
+	if cfg.GetServerer == nil {
+		cfg.GetServerer = &localServer{Config: cfg}
+	}
+
 	srv = &grpcServer{
 		Config: cfg,
 	}
 
+	if cfg.Metrics != nil {
+		srv.consumerLag = cfg.Metrics.Histogram(
+			"proglog_server_consumer_lag_records",
+			"Committed records a consume stream had yet to send, observed per record sent.",
+			[]float64{0, 1, 10, 100, 1000, 10000, 100000},
+		)
+	}
+
 	return srv, nil
 }
 
+// Produce appends the record to the log. If the log is replicated, it waits
+// for the acknowledgements the request asks for.
 func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
-	offset, err := s.CommitLog.Append(req.Record)
+	if err := s.authorize(ctx, DefaultTopic, produceAction); err != nil {
+		return nil, err
+	}
+
+	offset, err := s.append(ctx, req.Record, req.Acks)
 	if err != nil {
 		return nil, err
 	}
@@ -53,8 +159,54 @@ func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api
 	return &api.ProduceResponse{Offset: offset}, nil
 }
 
+// append appends the record to the log. If the log is replicated, it waits
+// for the acknowledgements acks asks for. Once the server is draining,
+// records are refused.
+func (c *Config) append(ctx context.Context, record *api.Record, acks api.Acks) (uint64, error) {
+	if c.isDraining() {
+		return 0, errDraining
+	}
+
+	if a, ok := c.CommitLog.(ackAppender); ok {
+		return a.AppendAcks(ctx, record, acks)
+	}
+
+	return c.CommitLog.Append(record)
+}
+
+// Consume reads the record at the requested offset once the log satisfies the
+// request's consistency level. With a max_wait, an offset past the end of the
+// log is waited for.
 func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api.ConsumeResponse, error) {
-	record, err := s.CommitLog.Read(req.Offset)
+	if err := s.authorize(ctx, DefaultTopic, consumeAction); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkConsistency(ctx, req); err != nil {
+		return nil, err
+	}
+
+	var wait time.Duration
+	if req.MaxWait != nil {
+		if err := req.MaxWait.CheckValid(); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid max_wait: %v", err)
+		}
+		wait = min(req.MaxWait.AsDuration(), maxConsumeWait)
+	}
+	if wait < 0 {
+		return nil, status.Error(codes.InvalidArgument, "max_wait can't be negative")
+	}
+
+	record, err := s.readWait(ctx, req.Offset, wait)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.ConsumeResponse{Record: record}, nil
+}
+
+func (s *grpcServer) read(offset uint64) (*api.ConsumeResponse, error) {
+	record, err := s.CommitLog.Read(offset)
 	if err != nil {
 		return nil, err
 	}
@@ -64,47 +216,117 @@ func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api
 
 // ProduceStream implements a bidirectional streaming RPC so the client can stream data
 // into the server's log and the server can tell the client whether each request succeded.
+//
+// Records are appended as they're received, while their acknowledgements are
+// awaited and sent in order here. Once produceWindow records are waiting,
+// the server stops receiving until the oldest is acknowledged. The first
+// failure, including a broken stream, ends the call with its error.
 func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
-	for {
-		req, err := stream.Recv()
-		if err != nil {
-			return nil
-		}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	window := make(chan produced, produceWindow)
+	recvErr := make(chan error, 1)
+	go func() {
+		defer close(window)
+		recvErr <- s.receiveProduces(ctx, stream, window)
+	}()
 
-		resp, err := s.Produce(stream.Context(), req)
+	// After the first failure the receiver is stopped, and what it had
+	// queued is dropped, so nothing is appended once the call returns.
+	var err error
+	for p := range window {
 		if err != nil {
-			return err
+			continue
 		}
 
-		if err = stream.Send(resp); err != nil {
-			return err
+		if err = s.acknowledge(ctx, stream, p); err != nil {
+			cancel()
 		}
 	}
+
+	if rerr := <-recvErr; err == nil {
+		err = rerr
+	}
+
+	return err
 }
 
 // ConsumeStream implements a server-side streaming RPC so the client can tell the server where in the log
 // to read records, and then the server will stream every record that follows - even records that aren't in
 // the log yet.
+//
+// The consistency level is checked once, before the first record; after that
+// the stream follows the log as it's written, until the server drains, or
+// ends at the high-water mark if the request asks it to.
+// Requests with a replica ID are follower fetches and are handed to the
+// replicated log.
 func (s *grpcServer) ConsumeStream(req *api.ConsumeRequest, stream api.Log_ConsumeStreamServer) error {
-	for {
-		select {
-		case <-stream.Context().Done():
-			return nil
-		default:
-			resp, err := s.Consume(stream.Context(), req)
-			switch err.(type) {
-			case nil:
-			case api.ErrOffsetOutOfRange:
-				continue
-			default:
-				return err
-			}
-
-			if err = stream.Send(resp); err != nil {
-				return err
-			}
-
-			req.Offset++
+	if req.ReplicaId != "" {
+		if err := s.authorize(stream.Context(), DefaultTopic, replicateAction); err != nil {
+			return err
 		}
+
+		f, ok := s.CommitLog.(replicaFetcher)
+		if !ok {
+			return status.Error(codes.FailedPrecondition, "not a replication leader")
+		}
+
+		return f.Fetch(stream.Context(), req.ReplicaId, req.Offset, stream.Send)
 	}
+
+	if err := s.authorize(stream.Context(), DefaultTopic, consumeAction); err != nil {
+		return err
+	}
+
+	if err := s.checkConsistency(stream.Context(), req); err != nil {
+		return err
+	}
+
+	if req.StopAtHighWatermark {
+		return s.consumeToHighWatermark(req, stream)
+	}
+
+	return s.follow(stream.Context(), req.Offset, func(record *api.Record) error {
+		if err := stream.Send(&api.ConsumeResponse{Record: record}); err != nil {
+			return err
+		}
+
+		s.observeLag(record.Offset)
+		return nil
+	})
+}
+
+// observeLag records how many committed records follow the one a consume
+// stream just sent at off.
+func (s *grpcServer) observeLag(off uint64) {
+	if s.consumerLag == nil {
+		return
+	}
+
+	h, ok := s.CommitLog.(highWatermarker)
+	if !ok {
+		return
+	}
+
+	var lag uint64
+	if hwm := h.HighWatermark(); hwm > off+1 {
+		lag = hwm - off - 1
+	}
+	s.consumerLag.Observe(float64(lag))
+}
+
+// GetServers returns every server in the deployment along with which one is
+// the leader and the offsets each one holds.
+func (s *grpcServer) GetServers(ctx context.Context, req *api.GetServersRequest) (*api.GetServersResponse, error) {
+	if err := s.authorize(ctx, clusterObject, describeAction); err != nil {
+		return nil, err
+	}
+
+	servers, err := s.GetServerer.GetServers()
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.GetServersResponse{Servers: servers}, nil
 }
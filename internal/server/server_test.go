@@ -1,20 +1,72 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	api "github.com/petrostrak/proglog/api/v1"
+	"github.com/petrostrak/proglog/internal/auth"
 	"github.com/petrostrak/proglog/internal/config"
 	"github.com/petrostrak/proglog/internal/log"
+	"github.com/petrostrak/proglog/internal/metrics"
+	"github.com/petrostrak/proglog/internal/trace"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
+// TestMain generates the certificates and ACL policy the tests use into a
+// temporary directory, so they don't depend on anything set up outside the
+// repo.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "server-test-config")
+	if err != nil {
+		panic(err)
+	}
+
+	config.SetDir(dir)
+	if err = config.GenerateCerts(dir); err != nil {
+		panic(err)
+	}
+
+	policy, err := os.ReadFile(filepath.Join("..", "..", "test", "policy.csv"))
+	if err != nil {
+		panic(err)
+	}
+
+	if err = os.WriteFile(config.ACLPolicyFile, policy, 0644); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestServer(t *testing.T) {
 	for scenario, fn := range map[string]func(
 		t *testing.T,
@@ -24,6 +76,9 @@ func TestServer(t *testing.T) {
 		"produce/consume a message to/from the log succeeeds": testProduceConsume,
 		"produce/consume stream succeeds":                     testProduceConsumeStream,
 		"consume past log boundary fails":                     testConsumePastBoundary,
+		"get servers describes the local node":                testGetServers,
+		"describe cluster names the leader":                   testDescribeCluster,
+		"admin rpcs manage the log":                           testManageLog,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			client, config, teardown := setupTest(t, nil)
@@ -43,46 +98,46 @@ func setupTest(t *testing.T, fn func(*Config)) (
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
 
-	clientTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
-		CertFile: config.ClientCertFile,
-		KeyFile:  config.ClientKeyFile,
-		CAFile:   config.CAFile,
-	})
-	require.NoError(t, err)
-
-	clientCreds := credentials.NewTLS(clientTLSConfig)
-	cc, err := grpc.NewClient(
+	cc := dialTest(
+		t,
 		l.Addr().String(),
-		grpc.WithTransportCredentials(clientCreds),
+		config.RootClientCertFile,
+		config.RootClientKeyFile,
 	)
-	require.NoError(t, err)
-
 	client = api.NewLogClient(cc)
 
-	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
-		CertFile:      config.ServerCertFile,
-		KeyFile:       config.ServerKeyFile,
-		CAFile:        config.CAFile,
-		ServerAddress: l.Addr().String(),
-		Server:        true,
-	})
+	dir, err := os.MkdirTemp("", "server-test")
 	require.NoError(t, err)
-	serverCreds := credentials.NewTLS(serverTLSConfig)
 
-	dir, err := os.CreateTemp("", "server-test")
+	clog, err := log.NewLog(dir, log.Config{})
 	require.NoError(t, err)
 
-	clog, err := log.NewLog(dir.Name(), log.Config{})
+	authorizer, err := auth.New(config.ACLPolicyFile)
 	require.NoError(t, err)
 
 	cfg = &Config{
-		CommitLog: clog,
+		CommitLog:  clog,
+		Authorizer: authorizer,
+		ServerID:   "server-test",
+		RPCAddr:    l.Addr().String(),
 	}
 
 	if fn != nil {
 		fn(cfg)
 	}
 
+	// Clients may skip their certificate if the server accepts tokens.
+	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:           config.ServerCertFile,
+		KeyFile:            config.ServerKeyFile,
+		CAFile:             config.CAFile,
+		ServerAddress:      l.Addr().String(),
+		Server:             true,
+		ClientCertOptional: cfg.Authenticator != nil,
+	})
+	require.NoError(t, err)
+	serverCreds := credentials.NewTLS(serverTLSConfig)
+
 	server, err := NewGRPCServer(cfg, grpc.Creds(serverCreds))
 	require.NoError(t, err)
 
@@ -94,9 +149,32 @@ func setupTest(t *testing.T, fn func(*Config)) (
 		server.Stop()
 		cc.Close()
 		l.Close()
+		clog.Remove()
 	}
 }
 
+// dialTest opens a client connection to addr identified by the given
+// certificate.
+func dialTest(t *testing.T, addr, certFile, keyFile string) *grpc.ClientConn {
+	t.Helper()
+
+	clientTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+
+	clientCreds := credentials.NewTLS(clientTLSConfig)
+	cc, err := grpc.NewClient(
+		addr,
+		grpc.WithTransportCredentials(clientCreds),
+	)
+	require.NoError(t, err)
+
+	return cc
+}
+
 func testProduceConsume(t *testing.T, client api.LogClient, config *Config) {
 	ctx := context.Background()
 
@@ -201,3 +279,1678 @@ func testProduceConsumeStream(
 		}
 	}
 }
+
+func testGetServers(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+
+	res, err := client.GetServers(ctx, &api.GetServersRequest{})
+	require.NoError(t, err)
+	require.Len(t, res.Servers, 1)
+
+	srv := res.Servers[0]
+	require.Equal(t, config.ServerID, srv.Id)
+	require.Equal(t, config.RPCAddr, srv.RpcAddr)
+	require.True(t, srv.IsLeader)
+	require.Len(t, srv.Partitions, 1)
+	require.Equal(t, uint64(0), srv.Partitions[0].LowestOffset)
+	require.Equal(t, uint64(2), srv.Partitions[0].HighestOffset)
+}
+
+func testDescribeCluster(t *testing.T, client api.LogClient, cfg *Config) {
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.RootClientCertFile,
+		config.RootClientKeyFile,
+	)
+	defer cc.Close()
+
+	res, err := api.NewAdminClient(cc).DescribeCluster(
+		context.Background(),
+		&api.DescribeClusterRequest{},
+	)
+	require.NoError(t, err)
+	require.Len(t, res.Servers, 1)
+	require.Equal(t, cfg.ServerID, res.LeaderId)
+	require.Equal(t, cfg.ServerID, res.LocalId)
+}
+
+func testManageLog(t *testing.T, client api.LogClient, cfg *Config) {
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.RootClientCertFile,
+		config.RootClientKeyFile,
+	)
+	defer cc.Close()
+
+	admin := api.NewAdminClient(cc)
+	ctx := context.Background()
+
+	produce := func(n int) {
+		for i := 0; i < n; i++ {
+			_, err := client.Produce(ctx, &api.ProduceRequest{
+				Record: &api.Record{Value: []byte("hello world")},
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	produce(3)
+	roll, err := admin.RollSegment(ctx, &api.RollSegmentRequest{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), roll.BaseOffset)
+	produce(2)
+
+	desc, err := admin.DescribeLog(ctx, &api.DescribeLogRequest{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), desc.LowestOffset)
+	require.Equal(t, uint64(4), desc.HighestOffset)
+	require.Equal(t, uint64(5), desc.HighWatermark)
+	require.Len(t, desc.Segments, 2)
+	require.Equal(t, uint64(3), desc.Segments[0].NextOffset)
+	require.NotZero(t, desc.Segments[0].StoreBytes)
+	require.Equal(t, uint64(3*12), desc.Segments[0].IndexBytes)
+
+	// Segments still holding records below the offset are kept.
+	truncate, err := admin.TruncateLog(ctx, &api.TruncateLogRequest{BeforeOffset: 2})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), truncate.LowestOffset)
+
+	truncate, err = admin.TruncateLog(ctx, &api.TruncateLogRequest{BeforeOffset: 3})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), truncate.LowestOffset)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 2})
+	require.True(t, api.IsOffsetOutOfRange(err))
+
+	// Nothing above the high-water mark can be truncated.
+	_, err = admin.TruncateLog(ctx, &api.TruncateLogRequest{BeforeOffset: 6})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Without a retention policy everything is kept.
+	retention, err := admin.EnforceRetention(ctx, &api.EnforceRetentionRequest{})
+	require.NoError(t, err)
+	require.Zero(t, retention.RemovedSegments)
+	require.Equal(t, uint64(3), retention.LowestOffset)
+
+	_, err = admin.DeleteLog(ctx, &api.DeleteLogRequest{})
+	require.NoError(t, err)
+
+	desc, err = admin.DescribeLog(ctx, &api.DescribeLogRequest{})
+	require.NoError(t, err)
+	require.Len(t, desc.Segments, 1)
+	require.Equal(t, uint64(5), desc.LowestOffset)
+	require.Equal(t, uint64(5), desc.Segments[0].NextOffset)
+
+	// Offsets aren't reused.
+	res, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello again")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), res.Offset)
+}
+
+// TestUnauthorized tests that a client whose certificate the policy doesn't
+// permit is rejected.
+func TestUnauthorized(t *testing.T) {
+	_, cfg, teardown := setupTest(t, nil)
+	defer teardown()
+
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.NobodyClientCertFile,
+		config.NobodyClientKeyFile,
+	)
+	defer cc.Close()
+
+	nobody := api.NewLogClient(cc)
+	ctx := context.Background()
+
+	produce, err := nobody.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.Nil(t, produce)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	consume, err := nobody.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.Nil(t, consume)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := nobody.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = nobody.GetServers(ctx, &api.GetServersRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = api.NewAdminClient(cc).DescribeCluster(
+		ctx,
+		&api.DescribeClusterRequest{},
+	)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = api.NewAdminClient(cc).DeleteLog(ctx, &api.DeleteLogRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// TestAuthorizeObjects tests that calls on the log are authorized on its
+// topic, and describing the servers on the cluster.
+func TestAuthorizeObjects(t *testing.T) {
+	policy := filepath.Join(t.TempDir(), "policy.csv")
+	err := os.WriteFile(policy, []byte("root, default, produce\nroot, cluster, describe\n"), 0644)
+	require.NoError(t, err)
+
+	client, _, teardown := setupTest(t, func(cfg *Config) {
+		authorizer, err := auth.New(policy)
+		require.NoError(t, err)
+		cfg.Authorizer = authorizer
+	})
+	defer teardown()
+
+	ctx := context.Background()
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	_, err = client.GetServers(ctx, &api.GetServersRequest{})
+	require.NoError(t, err)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.ErrorContains(t, err, "consume to default")
+}
+
+// fakeReplica turns the test's commit log into a follower whose freshness the
+// test controls.
+type fakeReplica struct {
+	CommitLog
+	lastContact time.Time
+	readIndex   uint64
+	waited      uint64
+}
+
+func (r *fakeReplica) IsLeader() bool {
+	return false
+}
+
+func (r *fakeReplica) LastContact() time.Time {
+	return r.lastContact
+}
+
+func (r *fakeReplica) ReadIndex(ctx context.Context) (uint64, error) {
+	return r.readIndex, nil
+}
+
+func (r *fakeReplica) WaitApplied(ctx context.Context, off uint64) error {
+	r.waited = off
+	return nil
+}
+
+func TestConsistency(t *testing.T) {
+	replica := &fakeReplica{}
+	client, _, teardown := setupTest(t, func(c *Config) {
+		replica.CommitLog = c.CommitLog
+		c.CommitLog = replica
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	// Any replica serves the read however stale it is.
+	_, err = client.Consume(ctx, &api.ConsumeRequest{
+		Offset: produce.Offset,
+	})
+	require.NoError(t, err)
+
+	// Bounded staleness fails on a replica that lost its leader.
+	_, err = client.Consume(ctx, &api.ConsumeRequest{
+		Offset:       produce.Offset,
+		Consistency:  api.Consistency_CONSISTENCY_BOUNDED_STALENESS,
+		MaxStaleness: durationpb.New(time.Second),
+	})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	replica.lastContact = time.Now()
+	_, err = client.Consume(ctx, &api.ConsumeRequest{
+		Offset:       produce.Offset,
+		Consistency:  api.Consistency_CONSISTENCY_BOUNDED_STALENESS,
+		MaxStaleness: durationpb.New(time.Second),
+	})
+	require.NoError(t, err)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{
+		Offset:      produce.Offset,
+		Consistency: api.Consistency_CONSISTENCY_BOUNDED_STALENESS,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Linearizable reads wait for the leader's read index.
+	replica.readIndex = produce.Offset + 1
+	_, err = client.Consume(ctx, &api.ConsumeRequest{
+		Offset:      produce.Offset,
+		Consistency: api.Consistency_CONSISTENCY_LINEARIZABLE,
+	})
+	require.NoError(t, err)
+	require.Equal(t, produce.Offset+1, replica.waited)
+}
+
+// TestReplication tests that a follower replicates from a leader served over
+// gRPC, and that acks=all waits for it.
+func TestReplication(t *testing.T) {
+	leaderDir, err := os.MkdirTemp("", "replication-test-leader")
+	require.NoError(t, err)
+	followerDir, err := os.MkdirTemp("", "replication-test-follower")
+	require.NoError(t, err)
+
+	c := log.Config{}
+	c.Replication.FetchWait = 10 * time.Millisecond
+
+	var leader *log.Leader
+	client, cfg, teardown := setupTest(t, func(cfg *Config) {
+		leader, err = log.NewLeader(leaderDir, c)
+		require.NoError(t, err)
+		cfg.CommitLog = leader
+	})
+	defer teardown()
+	defer leader.Remove()
+
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.RootClientCertFile,
+		config.RootClientKeyFile,
+	)
+	defer cc.Close()
+
+	follower, err := log.NewFollower(followerDir, c, "follower", cc)
+	require.NoError(t, err)
+	defer follower.Remove()
+
+	require.Eventually(t, func() bool {
+		return len(leader.InSyncReplicas()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	ctx := context.Background()
+	want := &api.Record{Value: []byte("hello world")}
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: want,
+		Acks:   api.Acks_ACKS_ALL,
+	})
+	require.NoError(t, err)
+
+	// The leader committed the record, so the follower has it and learns
+	// that it's committed on its next fetch.
+	got, err := follower.ReadUncommitted(produce.Offset)
+	require.NoError(t, err)
+	require.Equal(t, want.Value, got.Value)
+
+	idx, err := follower.ReadIndex(ctx)
+	require.NoError(t, err)
+	require.Equal(t, produce.Offset+1, idx)
+	require.NoError(t, follower.WaitApplied(ctx, idx))
+
+	got, err = follower.Read(produce.Offset)
+	require.NoError(t, err)
+	require.Equal(t, want.Value, got.Value)
+
+	_, err = follower.Append(want)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// TestReplicationBootstrap tests that a follower the leader has truncated past
+// restores a snapshot of the leader's log before fetching.
+func TestReplicationBootstrap(t *testing.T) {
+	leaderDir, err := os.MkdirTemp("", "bootstrap-test-leader")
+	require.NoError(t, err)
+	followerDir, err := os.MkdirTemp("", "bootstrap-test-follower")
+	require.NoError(t, err)
+
+	c := log.Config{}
+	c.Segment.MaxStoreBytes = 32
+	c.Replication.FetchWait = 10 * time.Millisecond
+
+	var leader *log.Leader
+	client, cfg, teardown := setupTest(t, func(cfg *Config) {
+		leader, err = log.NewLeader(leaderDir, c)
+		require.NoError(t, err)
+		cfg.CommitLog = leader
+	})
+	defer teardown()
+	defer leader.Remove()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, err = client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, leader.Truncate(1))
+
+	lowest, err := leader.LowestOffset()
+	require.NoError(t, err)
+	require.NotZero(t, lowest)
+
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.RootClientCertFile,
+		config.RootClientKeyFile,
+	)
+	defer cc.Close()
+
+	follower, err := log.NewFollower(followerDir, c, "follower", cc)
+	require.NoError(t, err)
+	defer follower.Remove()
+
+	require.Eventually(t, func() bool {
+		_, err := follower.Read(4)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	off, err := follower.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, lowest, off)
+}
+
+// TestTokenAuthentication tests that clients without a certificate can
+// authenticate with a token or API key, and that the policy applies to the
+// token's subject as it does to a certificate's.
+func TestTokenAuthentication(t *testing.T) {
+	secret := []byte("secret")
+	_, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Authenticator = auth.NewTokenAuthenticator(secret)
+	})
+	defer teardown()
+
+	dial := func(creds auth.TokenCredentials) api.LogClient {
+		clientTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+			CAFile: config.CAFile,
+		})
+		require.NoError(t, err)
+
+		opts := []grpc.DialOption{
+			grpc.WithTransportCredentials(credentials.NewTLS(clientTLSConfig)),
+		}
+		if creds != "" {
+			opts = append(opts, grpc.WithPerRPCCredentials(creds))
+		}
+
+		cc, err := grpc.NewClient(cfg.RPCAddr, opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { cc.Close() })
+
+		return api.NewLogClient(cc)
+	}
+
+	ctx := context.Background()
+	req := &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}}
+
+	root, err := auth.NewToken(secret, "root", time.Minute)
+	require.NoError(t, err)
+	_, err = dial(auth.TokenCredentials(root)).Produce(ctx, req)
+	require.NoError(t, err)
+
+	nobody, err := auth.NewToken(secret, "nobody", time.Minute)
+	require.NoError(t, err)
+	_, err = dial(auth.TokenCredentials(nobody)).Produce(ctx, req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	forged, err := auth.NewToken([]byte("other"), "root", time.Minute)
+	require.NoError(t, err)
+	_, err = dial(auth.TokenCredentials(forged)).Produce(ctx, req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = dial("").Produce(ctx, req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// TestHTTPAuthentication tests that the HTTP server authenticates and
+// authorizes requests like the gRPC server.
+func TestHTTPAuthentication(t *testing.T) {
+	secret := []byte("secret")
+	_, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Authenticator = auth.NewTokenAuthenticator(secret)
+	})
+	defer teardown()
+
+	srv := NewHTTPServer("", cfg)
+	require.Equal(t, httpReadHeaderTimeout, srv.ReadHeaderTimeout)
+
+	produce := func(token string) int {
+		r := httptest.NewRequest(
+			http.MethodPost,
+			"/",
+			bytes.NewBufferString(`{"record":{"value":"aGVsbG8="}}`),
+		)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	root, err := auth.NewToken(secret, "root", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, produce(root))
+
+	nobody, err := auth.NewToken(secret, "nobody", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusForbidden, produce(nobody))
+
+	require.Equal(t, http.StatusUnauthorized, produce("bad-token"))
+	require.Equal(t, http.StatusUnauthorized, produce(""))
+
+	// Callers without credentials are refused even without a policy.
+	cfg.Authorizer = nil
+	require.Equal(t, http.StatusUnauthorized, produce(""))
+	require.Equal(t, http.StatusOK, produce(nobody))
+}
+
+// syncBuffer is a bytes.Buffer the server's goroutines can write to while the
+// test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+// TestObservability tests that every call is logged, counted and traced, and
+// that its span joins the trace the client sent.
+func TestObservability(t *testing.T) {
+	var logs, spans syncBuffer
+	registry := metrics.NewRegistry()
+
+	client, _, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+		cfg.Metrics = registry
+		cfg.Tracer = trace.NewTracer(trace.NewWriterExporter(&spans))
+	})
+	defer teardown()
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := metadata.AppendToOutgoingContext(
+		context.Background(),
+		"traceparent", traceparent,
+	)
+
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: 1})
+	require.Error(t, err)
+	consumeCode := status.Code(err).String()
+
+	produce := "/log.v1.Log/Produce"
+	consume := "/log.v1.Log/Consume"
+
+	// The access log is written after the response, so wait for it.
+	var entries []map[string]any
+	require.Eventually(t, func() bool {
+		entries = nil
+		dec := json.NewDecoder(bytes.NewReader(logs.Bytes()))
+		for dec.More() {
+			var e map[string]any
+			require.NoError(t, dec.Decode(&e))
+			entries = append(entries, e)
+		}
+		return len(entries) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, produce, entries[0]["method"])
+	require.Equal(t, "OK", entries[0]["code"])
+	require.Equal(t, "root", entries[0]["subject"])
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entries[0]["trace_id"])
+	require.Equal(t, "WARN", entries[1]["level"])
+	require.Equal(t, consumeCode, entries[1]["code"])
+
+	handled := registry.Counter("grpc_server_handled_total", "", "method", "code")
+	require.Equal(t, float64(1), handled.Value(produce, "OK"))
+	require.Equal(t, float64(1), handled.Value(consume, consumeCode))
+
+	latency := registry.Histogram("grpc_server_handling_seconds", "", nil, "method")
+	require.Equal(t, uint64(1), latency.Count(produce))
+
+	var span trace.SpanData
+	require.NoError(t, json.NewDecoder(bytes.NewReader(spans.Bytes())).Decode(&span))
+	require.Equal(t, produce, span.Name)
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+	require.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+	require.Equal(t, trace.StatusOK, span.Status)
+	require.Equal(t, "root", span.Attributes["enduser.id"])
+}
+
+// TestMetricsEndpoint tests that /metrics reports the server's and the
+// log's metrics together.
+func TestMetricsEndpoint(t *testing.T) {
+	dir, err := os.MkdirTemp("", "metrics-test")
+	require.NoError(t, err)
+
+	registry := metrics.NewRegistry()
+	client, cfg, teardown := setupTest(t, func(cfg *Config) {
+		c := log.Config{Metrics: registry}
+		clog, err := log.NewLog(dir, c)
+		require.NoError(t, err)
+		cfg.CommitLog = clog
+		cfg.Metrics = registry
+	})
+	defer teardown()
+	defer cfg.CommitLog.(*log.Log).Remove()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		_, err = client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		_, err = stream.Recv()
+		require.NoError(t, err)
+	}
+
+	srv := NewHTTPServer("", cfg)
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		srv.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(
+			scrape(),
+			"proglog_server_consumer_lag_records_count 2\n",
+		)
+	}, time.Second, 10*time.Millisecond)
+
+	body := scrape()
+	for _, want := range []string{
+		`grpc_server_handled_total{method="/log.v1.Log/Produce",code="OK"} 2`,
+		`proglog_server_active_streams{method="/log.v1.Log/ConsumeStream"} 1`,
+		`proglog_server_consumer_lag_records_bucket{le="0"} 1`,
+		"proglog_log_next_offset 2\n",
+		"proglog_log_segments 1\n",
+	} {
+		require.Contains(t, body, want)
+	}
+}
+
+// TestHealth tests that the health service reports the server as serving
+// until its log closes, and a follower as not serving once it stops hearing
+// from its leader.
+func TestHealth(t *testing.T) {
+	healthWatchInterval = 10 * time.Millisecond
+
+	_, cfg, teardown := setupTest(t, nil)
+	defer teardown()
+
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.RootClientCertFile,
+		config.RootClientKeyFile,
+	)
+	defer cc.Close()
+
+	health := healthpb.NewHealthClient(cc)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, service := range []string{"", "log.v1.Log"} {
+		res, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+	}
+
+	_, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	watch, err := health.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	res, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+
+	require.NoError(t, cfg.CommitLog.(*log.Log).Close())
+	res, err = watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, res.Status)
+
+	// A follower is healthy while it hears from its leader.
+	replica := &fakeReplica{lastContact: time.Now()}
+	follower := newhealthServer(&Config{
+		CommitLog:     replica,
+		LeaderTimeout: time.Minute,
+	})
+	st, err := follower.status("")
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, st)
+
+	replica.lastContact = time.Now().Add(-2 * time.Minute)
+	st, err = follower.status("")
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, st)
+}
+
+// TestReflection tests that tools can discover the log service when
+// reflection is on.
+func TestReflection(t *testing.T) {
+	_, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Reflection = true
+	})
+	defer teardown()
+
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.RootClientCertFile,
+		config.RootClientKeyFile,
+	)
+	defer cc.Close()
+
+	stream, err := reflectionpb.NewServerReflectionClient(cc).ServerReflectionInfo(
+		context.Background(),
+	)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}))
+
+	res, err := stream.Recv()
+	require.NoError(t, err)
+
+	var services []string
+	for _, s := range res.GetListServicesResponse().Service {
+		services = append(services, s.Name)
+	}
+	require.Contains(t, services, "log.v1.Log")
+	require.Contains(t, services, "grpc.health.v1.Health")
+}
+
+// TestHTTPAndGRPC tests that records produced over either protocol can be
+// consumed over the other, because both serve the same log.
+func TestHTTPAndGRPC(t *testing.T) {
+	secret := []byte("secret")
+	client, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Authenticator = auth.NewTokenAuthenticator(secret)
+	})
+	defer teardown()
+
+	ts := httptest.NewServer(NewHTTPServer("", cfg).Handler)
+	defer ts.Close()
+
+	token, err := auth.NewToken(secret, "root", time.Minute)
+	require.NoError(t, err)
+
+	// The original JSON API's routes are served by the gateway, so they
+	// take and return the protobuf JSON encoding.
+	do := func(method string, body proto.Message, out proto.Message) int {
+		b, err := protojson.Marshal(body)
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(method, ts.URL, bytes.NewReader(b))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			b, err = io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, protojson.Unmarshal(b, out))
+		}
+		return resp.StatusCode
+	}
+
+	ctx := context.Background()
+	produced, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("from grpc")},
+	})
+	require.NoError(t, err)
+
+	consumed := &api.ConsumeResponse{}
+	code := do(http.MethodGet, &api.ConsumeRequest{Offset: produced.Offset}, consumed)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []byte("from grpc"), consumed.Record.Value)
+
+	res := &api.ProduceResponse{}
+	code = do(http.MethodPost, &api.ProduceRequest{Record: &api.Record{Value: []byte("from http")}}, res)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, produced.Offset+1, res.Offset)
+
+	got, err := client.Consume(ctx, &api.ConsumeRequest{Offset: res.Offset})
+	require.NoError(t, err)
+	require.Equal(t, []byte("from http"), got.Record.Value)
+
+	code = do(http.MethodGet, &api.ConsumeRequest{Offset: res.Offset + 1}, nil)
+	require.Equal(t, http.StatusNotFound, code)
+
+	// Only the root path is the original API's, not everything under it.
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/nothing/here", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// TestREST tests the versioned REST routes, including their JSON errors.
+func TestREST(t *testing.T) {
+	secret := []byte("secret")
+	_, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Authenticator = auth.NewTokenAuthenticator(secret)
+	})
+	defer teardown()
+
+	ts := httptest.NewServer(NewHTTPServer("", cfg).Handler)
+	defer ts.Close()
+
+	token, err := auth.NewToken(secret, "root", time.Minute)
+	require.NoError(t, err)
+
+	do := func(method, path, body string, out any) *http.Response {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+		return resp
+	}
+
+	for i := 0; i < 3; i++ {
+		var res ProduceResponse
+		resp := do(
+			http.MethodPost,
+			"/v1/topics/default/records",
+			`{"value":"aGVsbG8="}`,
+			&res,
+		)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		require.Equal(t, uint64(i), res.Offset)
+		require.Equal(
+			t,
+			fmt.Sprintf("/v1/topics/default/records/%d", i),
+			resp.Header.Get("Location"),
+		)
+	}
+
+	var record Record
+	resp := do(http.MethodGet, "/v1/topics/default/records/1", "", &record)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, Record{Value: []byte("hello"), Offset: 1}, record)
+
+	var page RecordsResponse
+	resp = do(http.MethodGet, "/v1/topics/default/records?from=1&limit=5", "", &page)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, page.Records, 2)
+	require.Equal(t, uint64(3), page.NextOffset)
+
+	resp = do(http.MethodGet, "/v1/topics/default/records?from=3", "", &page)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Empty(t, page.Records)
+	require.Equal(t, uint64(3), page.NextOffset)
+
+	for _, tc := range []struct {
+		method, path string
+		want         ErrorBody
+	}{
+		{
+			http.MethodGet, "/v1/topics/default/records/3",
+			ErrorBody{Code: 404, Status: "OUT_OF_RANGE", Reason: api.ReasonOffsetOutOfRange},
+		},
+		{
+			http.MethodGet, "/v1/topics/orders/records/0",
+			ErrorBody{Code: 404, Status: "NOT_FOUND", Reason: api.ReasonTopicNotFound},
+		},
+		{
+			http.MethodGet, "/v1/topics/default/records/abc",
+			ErrorBody{Code: 400, Status: "INVALID_ARGUMENT"},
+		},
+		{
+			http.MethodGet, "/v1/topics/default/records?limit=0",
+			ErrorBody{Code: 400, Status: "INVALID_ARGUMENT"},
+		},
+	} {
+		var res ErrorResponse
+		resp = do(tc.method, tc.path, "", &res)
+		require.Equal(t, tc.want.Code, resp.StatusCode, tc.path)
+		res.Error.Message = ""
+		require.Equal(t, tc.want, res.Error, tc.path)
+	}
+
+	// Bodies are limited like the gateway's.
+	var res ErrorResponse
+	body := `{"value":"` + strings.Repeat("A", maxBodyBytes) + `"}`
+	resp = do(http.MethodPost, "/v1/topics/default/records", body, &res)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, "INVALID_ARGUMENT", res.Error.Status)
+	require.Contains(t, res.Error.Message, "larger than")
+}
+
+// TestSSE tests that the events endpoint follows the log as it's written and
+// resumes after Last-Event-ID.
+func TestSSE(t *testing.T) {
+	secret := []byte("secret")
+	client, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Authenticator = auth.NewTokenAuthenticator(secret)
+	})
+	defer teardown()
+
+	ts := httptest.NewServer(NewHTTPServer("", cfg).Handler)
+	defer ts.Close()
+
+	token, err := auth.NewToken(secret, "root", time.Minute)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	produce := func(value string) {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte(value)},
+		})
+		require.NoError(t, err)
+	}
+
+	// tail opens the stream and returns a function that reads its next
+	// event's ID and data.
+	tail := func(ctx context.Context, lastEventID string) func() (string, Record) {
+		req, err := http.NewRequestWithContext(
+			ctx,
+			http.MethodGet,
+			ts.URL+"/v1/topics/default/events?from=0",
+			nil,
+		)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		scanner := bufio.NewScanner(resp.Body)
+		return func() (string, Record) {
+			var id string
+			var record Record
+			for scanner.Scan() {
+				line := scanner.Text()
+				switch {
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "data: "):
+					data := strings.TrimPrefix(line, "data: ")
+					require.NoError(t, json.Unmarshal([]byte(data), &record))
+				case line == "" && id != "":
+					return id, record
+				}
+			}
+			t.Fatal("stream ended:", scanner.Err())
+			return "", Record{}
+		}
+	}
+
+	produce("first")
+	produce("second")
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	next := tail(streamCtx, "")
+
+	id, record := next()
+	require.Equal(t, "0", id)
+	require.Equal(t, []byte("first"), record.Value)
+
+	id, _ = next()
+	require.Equal(t, "1", id)
+
+	// Records produced while the stream is open arrive as they're written.
+	produce("third")
+	id, record = next()
+	require.Equal(t, "2", id)
+	require.Equal(t, []byte("third"), record.Value)
+	cancel()
+
+	// Reconnecting with the last ID resumes after it.
+	streamCtx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	next = tail(streamCtx, "1")
+	id, record = next()
+	require.Equal(t, "2", id)
+	require.Equal(t, []byte("third"), record.Value)
+}
+
+// TestWebSocket tests producing and subscribing over the WebSocket gateway,
+// and that its messages are authorized like other calls.
+func TestWebSocket(t *testing.T) {
+	secret := []byte("secret")
+	client, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Authenticator = auth.NewTokenAuthenticator(secret)
+	})
+	defer teardown()
+
+	ts := httptest.NewServer(NewHTTPServer("", cfg).Handler)
+	defer ts.Close()
+
+	dial := func(subject string) *websocket.Conn {
+		token, err := auth.NewToken(secret, subject, time.Minute)
+		require.NoError(t, err)
+
+		c, err := websocket.NewConfig(
+			"ws"+strings.TrimPrefix(ts.URL, "http")+"/v1/topics/default/ws",
+			ts.URL,
+		)
+		require.NoError(t, err)
+		c.Header.Set("Authorization", "Bearer "+token)
+
+		ws, err := websocket.DialConfig(c)
+		require.NoError(t, err)
+		return ws
+	}
+
+	ws := dial("root")
+	defer ws.Close()
+
+	send := func(msg WebSocketMessage) {
+		require.NoError(t, websocket.JSON.Send(ws, msg))
+	}
+	recv := func() WebSocketMessage {
+		var msg WebSocketMessage
+		require.NoError(t, websocket.JSON.Receive(ws, &msg))
+		return msg
+	}
+
+	send(WebSocketMessage{Type: "produce", ID: "a", Value: []byte("first")})
+	require.Equal(t, WebSocketMessage{Type: "ack", ID: "a", Offset: 0}, recv())
+
+	// Records produced over gRPC show up in the subscription too.
+	send(WebSocketMessage{Type: "subscribe", ID: "sub", Offset: 0})
+	msg := recv()
+	require.Equal(t, "record", msg.Type)
+	require.Equal(t, []byte("first"), msg.Record.Value)
+
+	_, err := client.Produce(context.Background(), &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("second")},
+	})
+	require.NoError(t, err)
+	msg = recv()
+	require.Equal(t, "record", msg.Type)
+	require.Equal(t, uint64(1), msg.Record.Offset)
+
+	send(WebSocketMessage{Type: "bogus", ID: "b"})
+	msg = recv()
+	require.Equal(t, "error", msg.Type)
+	require.Equal(t, "INVALID_ARGUMENT", msg.Error.Status)
+
+	// A subject the policy doesn't permit gets errors, not acks.
+	nobody := dial("nobody")
+	defer nobody.Close()
+	require.NoError(t, websocket.JSON.Send(
+		nobody,
+		WebSocketMessage{Type: "produce", ID: "c", Value: []byte("denied")},
+	))
+	require.NoError(t, websocket.JSON.Receive(nobody, &msg))
+	require.Equal(t, "error", msg.Type)
+	require.Equal(t, "c", msg.ID)
+	require.Equal(t, http.StatusForbidden, msg.Error.Code)
+}
+
+// TestWebSocketOrigin tests that pages may only open WebSockets from the
+// server's own origin or an allowed one.
+func TestWebSocketOrigin(t *testing.T) {
+	_, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.WebSocketOrigins = []string{"https://app.example.com"}
+	})
+	defer teardown()
+
+	ts := httptest.NewServer(NewHTTPServer("", cfg).Handler)
+	defer ts.Close()
+
+	dial := func(origin string) error {
+		c, err := websocket.NewConfig(
+			"ws"+strings.TrimPrefix(ts.URL, "http")+"/v1/topics/default/ws",
+			origin,
+		)
+		require.NoError(t, err)
+
+		ws, err := websocket.DialConfig(c)
+		if err == nil {
+			ws.Close()
+		}
+		return err
+	}
+
+	require.NoError(t, dial(ts.URL))
+	require.NoError(t, dial("https://app.example.com"))
+	require.Error(t, dial("https://evil.example.com"))
+	require.Error(t, dial("http://app.example.com"))
+}
+
+// TestGateway tests that RPCs annotated in log.proto are served over
+// JSON/HTTP with the protobuf JSON encoding.
+func TestGateway(t *testing.T) {
+	secret := []byte("secret")
+	_, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Authenticator = auth.NewTokenAuthenticator(secret)
+	})
+	defer teardown()
+
+	ts := httptest.NewServer(NewHTTPServer("", cfg).Handler)
+	defer ts.Close()
+
+	token, err := auth.NewToken(secret, "root", time.Minute)
+	require.NoError(t, err)
+
+	do := func(ctx context.Context, method, path, body string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	decode := func(resp *http.Response, m proto.Message) {
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, protojson.Unmarshal(b, m), string(b))
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		resp := do(ctx, http.MethodPost, "/v1/log/records", `{"record":{"value":"aGVsbG8="}}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		var produced api.ProduceResponse
+		decode(resp, &produced)
+		require.Equal(t, uint64(i), produced.Offset)
+	}
+
+	resp := do(ctx, http.MethodGet, "/v1/log/records/1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var consumed api.ConsumeResponse
+	decode(resp, &consumed)
+	require.Equal(t, []byte("hello"), consumed.Record.Value)
+	require.Equal(t, uint64(1), consumed.Record.Offset)
+
+	resp = do(ctx, http.MethodGet, "/v1/servers", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var servers api.GetServersResponse
+	decode(resp, &servers)
+	require.Len(t, servers.Servers, 1)
+
+	resp = do(ctx, http.MethodGet, "/v1/log/records:range?from=0&maxRecords=1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var batch api.ConsumeRangeResponse
+	decode(resp, &batch)
+	require.Len(t, batch.Records, 1)
+	require.Equal(t, uint64(1), batch.NextOffset)
+
+	// Server streams are sent as a line of JSON per message.
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resp = do(sctx, http.MethodGet, "/v1/log/records:stream?offset=1&consistency=CONSISTENCY_ANY", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	line, err := bufio.NewReader(resp.Body).ReadBytes('\n')
+	require.NoError(t, err)
+	require.NoError(t, protojson.Unmarshal(line, &consumed))
+	require.Equal(t, uint64(1), consumed.Record.Offset)
+	cancel()
+	resp.Body.Close()
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               ErrorBody
+	}{
+		{
+			http.MethodGet, "/v1/log/records/2", "",
+			ErrorBody{Code: 404, Status: "OUT_OF_RANGE", Reason: api.ReasonOffsetOutOfRange},
+		},
+		{
+			http.MethodGet, "/v1/log/records/2?maxWait=0.05s", "",
+			ErrorBody{Code: 404, Status: "OUT_OF_RANGE", Reason: api.ReasonOffsetOutOfRange},
+		},
+		{
+			http.MethodGet, "/v1/log/records/abc", "",
+			ErrorBody{Code: 400, Status: "INVALID_ARGUMENT"},
+		},
+		{
+			http.MethodGet, "/v1/log/records/0?bogus=1", "",
+			ErrorBody{Code: 400, Status: "INVALID_ARGUMENT"},
+		},
+		{
+			http.MethodPost, "/v1/log/records", `{"record":`,
+			ErrorBody{Code: 400, Status: "INVALID_ARGUMENT"},
+		},
+		{
+			http.MethodPost, "/v1/log/records",
+			`{"record":{"value":"` + strings.Repeat("A", maxBodyBytes) + `"}}`,
+			ErrorBody{Code: 400, Status: "INVALID_ARGUMENT"},
+		},
+	} {
+		resp := do(ctx, tc.method, tc.path, tc.body)
+		require.Equal(t, tc.want.Code, resp.StatusCode, tc.path)
+
+		var res ErrorResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+		resp.Body.Close()
+		require.Equal(t, tc.want.Status, res.Error.Status, tc.path)
+		require.Equal(t, tc.want.Reason, res.Error.Reason, tc.path)
+	}
+
+	// Calls are authorized like gRPC calls.
+	token, err = auth.NewToken(secret, "nobody", time.Minute)
+	require.NoError(t, err)
+	resp = do(ctx, http.MethodGet, "/v1/log/records/0", "")
+	resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+// TestGatewayObservability tests that gateway calls are logged, measured
+// and traced like gRPC calls.
+func TestGatewayObservability(t *testing.T) {
+	var logs, spans syncBuffer
+	registry := metrics.NewRegistry()
+	secret := []byte("secret")
+
+	_, cfg, teardown := setupTest(t, func(cfg *Config) {
+		cfg.Authenticator = auth.NewTokenAuthenticator(secret)
+		cfg.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+		cfg.Metrics = registry
+		cfg.Tracer = trace.NewTracer(trace.NewWriterExporter(&spans))
+	})
+	defer teardown()
+
+	ts := httptest.NewServer(NewHTTPServer("", cfg).Handler)
+	defer ts.Close()
+
+	token, err := auth.NewToken(secret, "root", time.Minute)
+	require.NoError(t, err)
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/log/records", strings.NewReader(`{"record":{"value":"aGVsbG8="}}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("traceparent", traceparent)
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/v1/log/records:stream?offset=0", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, err = bufio.NewReader(resp.Body).ReadBytes('\n')
+	require.NoError(t, err)
+
+	produce := "/log.v1.Log/Produce"
+	stream := "/log.v1.Log/ConsumeStream"
+
+	streams := registry.Gauge("proglog_server_active_streams", "", "method")
+	require.Equal(t, float64(1), streams.Value(stream))
+
+	var entry map[string]any
+	require.Eventually(t, func() bool {
+		return json.Unmarshal(logs.Bytes(), &entry) == nil
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, produce, entry["method"])
+	require.Equal(t, "OK", entry["code"])
+	require.Equal(t, "root", entry["subject"])
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", entry["trace_id"])
+	require.NotEmpty(t, entry["peer"])
+
+	handled := registry.Counter("grpc_server_handled_total", "", "method", "code")
+	require.Equal(t, float64(1), handled.Value(produce, "OK"))
+
+	var span trace.SpanData
+	require.NoError(t, json.NewDecoder(bytes.NewReader(spans.Bytes())).Decode(&span))
+	require.Equal(t, produce, span.Name)
+	require.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		return streams.Value(stream) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestConsumeRange tests bounded reads, both as batches and as a stream that
+// ends at the high-water mark.
+func TestConsumeRange(t *testing.T) {
+	client, _, teardown := setupTest(t, nil)
+	defer teardown()
+
+	ctx := context.Background()
+	for _, v := range []string{"a", "bb", "ccc", "dddd", "eeeee"} {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte(v)},
+		})
+		require.NoError(t, err)
+	}
+
+	offsets := func(records []*api.Record) []uint64 {
+		var offs []uint64
+		for _, r := range records {
+			offs = append(offs, r.Offset)
+		}
+		return offs
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  *api.ConsumeRangeRequest
+		want []uint64
+		next uint64
+	}{
+		{"whole log", &api.ConsumeRangeRequest{}, []uint64{0, 1, 2, 3, 4}, 5},
+		{"max records", &api.ConsumeRangeRequest{From: 1, MaxRecords: 2}, []uint64{1, 2}, 3},
+		{"max bytes", &api.ConsumeRangeRequest{From: 1, MaxBytes: 5}, []uint64{1, 2}, 3},
+		{"oversized first record", &api.ConsumeRangeRequest{From: 4, MaxBytes: 1}, []uint64{4}, 5},
+		{"end offset", &api.ConsumeRangeRequest{From: 2, EndOffset: 4}, []uint64{2, 3}, 4},
+		{"end offset past the log", &api.ConsumeRangeRequest{From: 3, EndOffset: 10}, []uint64{3, 4}, 5},
+		{"caught up", &api.ConsumeRangeRequest{From: 5}, nil, 5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := client.ConsumeRange(ctx, tc.req)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, offsets(res.Records))
+			require.Equal(t, tc.next, res.NextOffset)
+			require.Equal(t, uint64(5), res.HighWatermark)
+		})
+	}
+
+	_, err := client.ConsumeRange(ctx, &api.ConsumeRangeRequest{MaxRecords: maxRangeLimit + 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.ConsumeRange(ctx, &api.ConsumeRangeRequest{From: 3, EndOffset: 3})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{
+		Offset:              2,
+		StopAtHighWatermark: true,
+	})
+	require.NoError(t, err)
+
+	var streamed []*api.Record
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		streamed = append(streamed, res.Record)
+	}
+	require.Equal(t, []uint64{2, 3, 4}, offsets(streamed))
+}
+
+// TestConsumeWait tests that a Consume with max_wait waits for the offset to
+// be appended.
+func TestConsumeWait(t *testing.T) {
+	client, _, teardown := setupTest(t, nil)
+	defer teardown()
+
+	ctx := context.Background()
+
+	start := time.Now()
+	_, err := client.Consume(ctx, &api.ConsumeRequest{
+		MaxWait: durationpb.New(50 * time.Millisecond),
+	})
+	require.True(t, api.IsOffsetOutOfRange(err), "%v", err)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	type result struct {
+		res *api.ConsumeResponse
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := client.Consume(ctx, &api.ConsumeRequest{
+			MaxWait: durationpb.New(10 * time.Second),
+		})
+		done <- result{res, err}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	select {
+	case r := <-done:
+		require.NoError(t, r.err)
+		require.Equal(t, []byte("hello world"), r.res.Record.Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("consume didn't wake up when the record was appended")
+	}
+
+	// The caller's deadline cuts the wait short.
+	dctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = client.Consume(dctx, &api.ConsumeRequest{
+		Offset:  1,
+		MaxWait: durationpb.New(10 * time.Second),
+	})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{
+		Offset:  1,
+		MaxWait: durationpb.New(-time.Second),
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{
+		Offset:  1,
+		MaxWait: &durationpb.Duration{Seconds: 1, Nanos: -1},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Waits are cut to maxConsumeWait.
+	defer func(wait time.Duration) { maxConsumeWait = wait }(maxConsumeWait)
+	maxConsumeWait = 50 * time.Millisecond
+	start = time.Now()
+	_, err = client.Consume(ctx, &api.ConsumeRequest{
+		Offset:  1,
+		MaxWait: durationpb.New(time.Hour),
+	})
+	require.True(t, api.IsOffsetOutOfRange(err), "%v", err)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+// heldLog acknowledges ACKS_ALL records only once the test releases them, and
+// counts how many records have been appended.
+type heldLog struct {
+	CommitLog
+	appended atomic.Int64
+	release  chan struct{}
+	// err, if set, is what WaitCommitted returns once released.
+	err error
+}
+
+func (l *heldLog) AppendUncommitted(record *api.Record, acks api.Acks) (uint64, error) {
+	l.appended.Add(1)
+	return l.CommitLog.Append(record)
+}
+
+func (l *heldLog) WaitCommitted(ctx context.Context, off uint64) error {
+	select {
+	case <-l.release:
+		return l.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TestProduceStreamWindow tests that ProduceStream appends ahead of its
+// acknowledgements, but only up to its window, and that failures end the
+// stream with their error.
+func TestProduceStreamWindow(t *testing.T) {
+	defer func(n int) { produceWindow = n }(produceWindow)
+	produceWindow = 2
+
+	held := &heldLog{release: make(chan struct{})}
+	client, cfg, teardown := setupTest(t, func(cfg *Config) {
+		held.CommitLog = cfg.CommitLog
+		cfg.CommitLog = held
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	stream, err := client.ProduceStream(ctx)
+	require.NoError(t, err)
+
+	const n = 10
+	go func() {
+		for i := 0; i < n; i++ {
+			err := stream.Send(&api.ProduceRequest{
+				Record: &api.Record{Value: []byte("hello world")},
+				Acks:   api.Acks_ACKS_ALL,
+			})
+			if err != nil {
+				return
+			}
+		}
+		stream.CloseSend()
+	}()
+
+	// Records are appended before the first is acknowledged, but the server
+	// stops reading once its window is full: one record being acknowledged,
+	// produceWindow queued and one waiting for room.
+	require.Eventually(t, func() bool {
+		return held.appended.Load() == int64(produceWindow+2)
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int64(produceWindow+2), held.appended.Load())
+
+	close(held.release)
+	for i := 0; i < n; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint64(i), res.Offset)
+	}
+	_, err = stream.Recv()
+	require.Equal(t, io.EOF, err)
+
+	// A failed produce ends the stream with its error.
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.NobodyClientCertFile,
+		config.NobodyClientKeyFile,
+	)
+	defer cc.Close()
+
+	stream, err = api.NewLogClient(cc).ProduceStream(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	}))
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// A record that fails to commit ends the stream even while the producer
+	// is waiting for its acknowledgement, and nothing more is appended.
+	held.appended.Store(0)
+	held.release = make(chan struct{})
+	held.err = status.Error(codes.Unavailable, "not enough replicas")
+	close(held.release)
+
+	stream, err = client.ProduceStream(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+		Acks:   api.Acks_ACKS_ALL,
+	}))
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	stream.Send(&api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+		Acks:   api.Acks_ACKS_ALL,
+	})
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int64(1), held.appended.Load())
+}
+
+// TestConsumeFlow tests that ConsumeFlow only sends as many records as the
+// client has granted credits for.
+func TestConsumeFlow(t *testing.T) {
+	client, _, teardown := setupTest(t, nil)
+	defer teardown()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+
+	stream, err := client.ConsumeFlow(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ConsumeFlowRequest{
+		Request: &api.ConsumeRequest{Offset: 1},
+		Credits: 2,
+	}))
+
+	received := make(chan uint64, 10)
+	go func() {
+		defer close(received)
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			received <- res.Record.Offset
+		}
+	}()
+
+	recv := func() uint64 {
+		select {
+		case off := <-received:
+			return off
+		case <-time.After(5 * time.Second):
+			t.Fatal("no record received")
+			return 0
+		}
+	}
+
+	require.Equal(t, uint64(1), recv())
+	require.Equal(t, uint64(2), recv())
+
+	select {
+	case off := <-received:
+		t.Fatalf("received record %d without credit", off)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, stream.Send(&api.ConsumeFlowRequest{Credits: 2}))
+	require.Equal(t, uint64(3), recv())
+	require.Equal(t, uint64(4), recv())
+
+	// Once the client stops granting credits and has spent them, the
+	// stream ends.
+	require.NoError(t, stream.CloseSend())
+	select {
+	case _, ok := <-received:
+		require.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream didn't end")
+	}
+
+	stream, err = client.ConsumeFlow(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.ConsumeFlowRequest{Credits: 1}))
+	_, err = stream.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestDrain tests that a draining server refuses produces, ends its streams
+// and reports itself as not serving, while still serving reads.
+func TestDrain(t *testing.T) {
+	client, cfg, teardown := setupTest(t, nil)
+	defer teardown()
+
+	cc := dialTest(
+		t,
+		cfg.RPCAddr,
+		config.RootClientCertFile,
+		config.RootClientKeyFile,
+	)
+	defer cc.Close()
+	health := healthpb.NewHealthClient(cc)
+
+	ctx := context.Background()
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	watch, err := health.Watch(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	res, err := watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+
+	cfg.Drain()
+	cfg.Drain()
+
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	res, err = watch.Recv()
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, res.Status)
+	_, err = watch.Recv()
+	require.Equal(t, io.EOF, err)
+
+	check, err := health.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check.Status)
+
+	_, err = client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), consume.Record.Value)
+}
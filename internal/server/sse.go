@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment, so
+// proxies don't close it.
+var sseKeepAlive = 15 * time.Second
+
+// handleTail streams records from the topic as Server-Sent Events, starting
+// at ?from= and following the log as it's written. Each event's ID is the
+// record's offset, so a client that reconnects with Last-Event-ID resumes
+// after the last record it got.
+func (s *HTTPServer) handleTail(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorize(r.Context(), DefaultTopic, consumeAction); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	if err := topic(r); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	from, err := queryUint(r, "from", 0)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		last, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			httpError(w, status.Errorf(codes.InvalidArgument, "invalid Last-Event-ID: %q", id))
+			return
+		}
+		from = last + 1
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	// The log is followed in another goroutine so the stream can send
+	// keep-alives while it waits.
+	ctx := r.Context()
+	records := make(chan *api.Record)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.follow(ctx, from, func(record *api.Record) error {
+			select {
+			case records <- record:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	for {
+		select {
+		case record := <-records:
+			b, err := json.Marshal(Record{Value: record.Value, Offset: record.Offset})
+			if err != nil {
+				return
+			}
+
+			_, err = fmt.Fprintf(w, "id: %d\nevent: record\ndata: %s\n\n", record.Offset, b)
+			if err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case err = <-done:
+			// The stream has already started, so errors go out as an
+			// event rather than a status.
+			if err != nil {
+				b, _ := json.Marshal(errorResponse(err))
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", b)
+				rc.Flush()
+			}
+			return
+		}
+
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
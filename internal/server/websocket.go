@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+
+	api "github.com/petrostrak/proglog/api/v1"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The types of the JSON messages sent over the WebSocket gateway.
+const (
+	// Sent by clients.
+	wsProduce   = "produce"
+	wsSubscribe = "subscribe"
+	// Sent by the server.
+	wsAck    = "ack"
+	wsRecord = "record"
+	wsError  = "error"
+)
+
+// WebSocketMessage is a message sent over the WebSocket gateway, one per
+// text frame.
+//
+// Clients send produce messages, each with a value to append, and the server
+// answers each with an ack carrying the record's offset, or an error. A
+// subscribe message starts streaming record messages from its offset,
+// replacing any earlier subscription. IDs are echoed back so clients can
+// match acks and errors to what they sent.
+type WebSocketMessage struct {
+	Type   string     `json:"type"`
+	ID     string     `json:"id,omitempty"`
+	Value  []byte     `json:"value,omitempty"`
+	Acks   api.Acks   `json:"acks,omitempty"`
+	Offset uint64     `json:"offset"`
+	Record *Record    `json:"record,omitempty"`
+	Error  *ErrorBody `json:"error,omitempty"`
+}
+
+// handleWebSocket upgrades the request to a WebSocket and serves the
+// gateway over it. The upgrade request is authenticated like any other, and
+// each produce and subscribe is authorized as it comes in.
+func (s *HTTPServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if err := topic(r); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	websocket.Server{
+		Handshake: s.checkOrigin,
+		Handler:   s.serveWebSocket,
+	}.ServeHTTP(w, r)
+}
+
+// checkOrigin refuses WebSockets opened by pages from other origins than the
+// server's own or WebSocketOrigins. Browsers send a page's cookies and client
+// certificate with the upgrade whatever its origin, so otherwise any site a
+// user visits could use their credentials. Clients other than browsers don't
+// send an Origin and aren't checked.
+func (s *HTTPServer) checkOrigin(c *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(c, r)
+	if err != nil {
+		return err
+	}
+	if origin == nil {
+		return nil
+	}
+
+	c.Origin = origin
+	if origin.Host == r.Host || slices.Contains(s.WebSocketOrigins, r.Header.Get("Origin")) {
+		return nil
+	}
+
+	return fmt.Errorf("origin %s not allowed", origin)
+}
+
+func (s *HTTPServer) serveWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// stop ends the current subscription.
+	stop := func() {}
+	defer func() { stop() }()
+
+	for {
+		var msg WebSocketMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			if !errors.Is(err, io.EOF) {
+				sendWebSocketError(ws, "", status.Error(codes.InvalidArgument, err.Error()))
+			}
+			return
+		}
+
+		switch msg.Type {
+		case wsProduce:
+			if err := s.authorize(ctx, DefaultTopic, produceAction); err != nil {
+				sendWebSocketError(ws, msg.ID, err)
+				continue
+			}
+
+			off, err := s.append(ctx, &api.Record{Value: msg.Value}, msg.Acks)
+			if err != nil {
+				sendWebSocketError(ws, msg.ID, err)
+				continue
+			}
+
+			if msg.Acks == api.Acks_ACKS_NONE {
+				continue
+			}
+
+			err = websocket.JSON.Send(ws, WebSocketMessage{Type: wsAck, ID: msg.ID, Offset: off})
+			if err != nil {
+				return
+			}
+		case wsSubscribe:
+			if err := s.authorize(ctx, DefaultTopic, consumeAction); err != nil {
+				sendWebSocketError(ws, msg.ID, err)
+				continue
+			}
+
+			stop()
+			subCtx, subCancel := context.WithCancel(ctx)
+			done := make(chan struct{})
+			stop = func() {
+				subCancel()
+				<-done
+			}
+
+			wg.Add(1)
+			go func(id string, off uint64) {
+				defer wg.Done()
+				defer close(done)
+
+				err := s.follow(subCtx, off, func(record *api.Record) error {
+					return websocket.JSON.Send(ws, WebSocketMessage{
+						Type:   wsRecord,
+						ID:     id,
+						Offset: record.Offset,
+						Record: &Record{Value: record.Value, Offset: record.Offset},
+					})
+				})
+				if err != nil && subCtx.Err() == nil {
+					sendWebSocketError(ws, id, err)
+				}
+			}(msg.ID, msg.Offset)
+		default:
+			sendWebSocketError(ws, msg.ID, status.Errorf(
+				codes.InvalidArgument,
+				"unknown message type: %q",
+				msg.Type,
+			))
+		}
+	}
+}
+
+func sendWebSocketError(ws *websocket.Conn, id string, err error) {
+	res := errorResponse(err)
+	websocket.JSON.Send(ws, WebSocketMessage{Type: wsError, ID: id, Error: &res.Error})
+}
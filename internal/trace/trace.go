@@ -0,0 +1,258 @@
+// Package trace records spans for the work a request does and hands them to
+// an exporter once they end. Trace context is carried between services in the
+// W3C traceparent format, so spans join traces started elsewhere.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span statuses, as in OpenTelemetry.
+const (
+	StatusUnset = "unset"
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// SpanData is a finished span as exporters receive it.
+type SpanData struct {
+	Name          string            `json:"name"`
+	TraceID       string            `json:"trace_id"`
+	SpanID        string            `json:"span_id"`
+	ParentSpanID  string            `json:"parent_span_id,omitempty"`
+	Start         time.Time         `json:"start"`
+	End           time.Time         `json:"end"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	Status        string            `json:"status"`
+	StatusMessage string            `json:"status_message,omitempty"`
+}
+
+// Exporter ships finished spans somewhere.
+type Exporter interface {
+	ExportSpan(SpanData) error
+}
+
+// WriterExporter writes each span to an io.Writer as a line of JSON.
+type WriterExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewWriterExporter exports spans to w, such as os.Stdout.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{enc: json.NewEncoder(w)}
+}
+
+// NewFileExporter exports spans by appending them to the named file.
+func NewFileExporter(name string) (*WriterExporter, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	e := NewWriterExporter(f)
+	e.c = f
+	return e, nil
+}
+
+func (e *WriterExporter) ExportSpan(s SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.enc.Encode(s)
+}
+
+// Close closes the file a file exporter writes to.
+func (e *WriterExporter) Close() error {
+	if e.c == nil {
+		return nil
+	}
+
+	return e.c.Close()
+}
+
+// Tracer starts spans and exports them when they end. A nil *Tracer starts
+// spans that are never exported.
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// SpanContext identifies a span within its trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid reports whether the trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceIDString returns the trace ID in hex, as it appears in traceparent
+// headers and exported spans.
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+// Traceparent formats the span context as a W3C traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf(
+		"00-%s-%s-01",
+		sc.TraceIDString(),
+		hex.EncodeToString(sc.SpanID[:]),
+	)
+}
+
+// ParseTraceparent parses a W3C traceparent header.
+func ParseTraceparent(v string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return sc, fmt.Errorf("invalid traceparent: %q", v)
+	}
+
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return sc, fmt.Errorf("invalid traceparent trace ID: %q", v)
+	}
+
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.SpanID) {
+		return sc, fmt.Errorf("invalid traceparent span ID: %q", v)
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent: %q", v)
+	}
+
+	return sc, nil
+}
+
+// Span is an operation being traced.
+type Span struct {
+	tracer *Tracer
+	name   string
+	sc     SpanContext
+	parent SpanContext
+	start  time.Time
+
+	mu         sync.Mutex
+	attributes map[string]string
+	status     string
+	message    string
+	ended      bool
+}
+
+type spanContextKey struct{}
+type remoteContextKey struct{}
+
+// FromContext returns the span in ctx, or nil if there isn't one.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
+
+// WithRemoteParent returns a context whose next span continues the trace sc
+// belongs to, such as one read from an incoming request's traceparent.
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, sc)
+}
+
+// Start starts a span named name. It's a child of the span in ctx, or of the
+// remote parent set with WithRemoteParent, or else starts a new trace.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	s := &Span{
+		tracer: t,
+		name:   name,
+		start:  time.Now(),
+		status: StatusUnset,
+	}
+
+	if parent := FromContext(ctx); parent != nil {
+		s.parent = parent.sc
+	} else if sc, ok := ctx.Value(remoteContextKey{}).(SpanContext); ok {
+		s.parent = sc
+	}
+
+	if s.parent.IsValid() {
+		s.sc.TraceID = s.parent.TraceID
+	} else {
+		rand.Read(s.sc.TraceID[:])
+	}
+	rand.Read(s.sc.SpanID[:])
+
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// SpanContext returns the span's IDs, to propagate to other services.
+func (s *Span) SpanContext() SpanContext {
+	return s.sc
+}
+
+// SetAttribute records a key-value pair on the span.
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// SetStatus sets whether the operation succeeded.
+func (s *Span) SetStatus(status, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status = status
+	s.message = message
+}
+
+// End finishes the span and exports it. Only the first call has an effect.
+func (s *Span) End() error {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return nil
+	}
+	s.ended = true
+
+	d := SpanData{
+		Name:          s.name,
+		TraceID:       s.sc.TraceIDString(),
+		SpanID:        hex.EncodeToString(s.sc.SpanID[:]),
+		Start:         s.start,
+		End:           time.Now(),
+		Attributes:    s.attributes,
+		Status:        s.status,
+		StatusMessage: s.message,
+	}
+	if s.parent.IsValid() {
+		d.ParentSpanID = hex.EncodeToString(s.parent.SpanID[:])
+	}
+	s.mu.Unlock()
+
+	if s.tracer == nil || s.tracer.exporter == nil {
+		return nil
+	}
+
+	return s.tracer.exporter.ExportSpan(d)
+}
@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewTracer(NewWriterExporter(&buf))
+
+	remote, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", remote.Traceparent())
+
+	ctx := WithRemoteParent(context.Background(), remote)
+	ctx, parent := tracer.Start(ctx, "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttribute("key", "value")
+	child.SetStatus(StatusError, "failed")
+	require.NoError(t, child.End())
+	require.NoError(t, child.End())
+	require.NoError(t, parent.End())
+
+	dec := json.NewDecoder(&buf)
+	var spans []SpanData
+	for dec.More() {
+		var s SpanData
+		require.NoError(t, dec.Decode(&s))
+		spans = append(spans, s)
+	}
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "child", spans[0].Name)
+	require.Equal(t, remote.TraceIDString(), spans[0].TraceID)
+	require.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	require.Equal(t, map[string]string{"key": "value"}, spans[0].Attributes)
+	require.Equal(t, StatusError, spans[0].Status)
+
+	require.Equal(t, "parent", spans[1].Name)
+	require.Equal(t, "00f067aa0ba902b7", spans[1].ParentSpanID)
+
+	// A nil tracer still hands out spans, it just doesn't export them.
+	var noop *Tracer
+	_, s := noop.Start(context.Background(), "noop")
+	require.True(t, s.SpanContext().IsValid())
+	require.NoError(t, s.End())
+
+	_, err = ParseTraceparent("00-zz-00f067aa0ba902b7-01")
+	require.Error(t, err)
+}